@@ -0,0 +1,75 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPty opens a pseudo terminal, returning its master side and the path of its slave side
+func openPty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo terminals: %v", err)
+	}
+	var unlock, number uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		master.Close()
+		t.Skipf("could not unlock pseudo terminal: %v", errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&number))); errno != 0 {
+		master.Close()
+		t.Skipf("could not get pseudo terminal number: %v", errno)
+	}
+	t.Cleanup(func() { master.Close() })
+	return master, fmt.Sprintf("/dev/pts/%d", number)
+}
+
+// serveASCII answers read holding registers requests with register address as value
+func serveASCII(master *os.File) {
+	reader := bufio.NewReader(master)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		request, err := hex.DecodeString(strings.TrimSpace(strings.TrimPrefix(line, ":")))
+		if err != nil || len(request) < 6 {
+			continue
+		}
+		address, quantity := uint16(request[2])<<8|uint16(request[3]), uint16(request[4])<<8|uint16(request[5])
+		response := []byte{request[0], request[1], byte(2 * quantity)}
+		for i := range quantity {
+			response = append(response, byte((address+i)>>8), byte(address+i))
+		}
+		var lrc byte
+		for _, b := range response {
+			lrc += b
+		}
+		response = append(response, -lrc)
+		fmt.Fprintf(master, ":%s\r\n", strings.ToUpper(hex.EncodeToString(response)))
+	}
+}
+func TestASCIIClientHandler(t *testing.T) {
+	master, slave := openPty(t)
+	go serveASCII(master)
+	channel := &model.Channel{Mode: model.ASCII, Connection: slave, Serial: &model.Serial{Baud: 9600, DataBits: 7, Parity: "N", StopBits: 2}}
+	handler := createModbusHandlerFactory(channel, channel.Connection)
+	client := modbus.NewClient(handler)
+	defer handler.(*modbus.ASCIIClientHandler).Close()
+
+	results, err := client.ReadHoldingRegisters(1, 10, 2)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if expected := []byte{0, 10, 0, 11}; string(expected) != string(results) {
+		t.Errorf("expected '% x', got '% x' instead", expected, results)
+	}
+}
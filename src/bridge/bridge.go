@@ -2,20 +2,33 @@ package bridge
 
 import (
 	"fmt"
+	"github.com/mvkvl/modbus"
 	"mbridge/model"
 	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Bridge interface {
 	Start()
 	Stop()
 	Get(reference string) (*model.Metric, error)
-	Set(reference string, value uint16) error
+	Read(reference string, maxAge time.Duration) (*model.Metric, error)
+	Set(reference string, value float64) error
+	SetRaw(reference string, value float64) error
+	SetMultiple(reference string, values []float64) error
+	SetRawMultiple(reference string, values []float64) error
+	SetText(reference string, text string) error
+	// Passthrough sends the request PDU as is to the slave of the channel
+	Passthrough(channel string, slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error)
 	List() []*model.Metric
 	Regs() []*model.Register
+	Devices() []model.DeviceState
+	Channels() []model.ChannelState
 	Flush()
+	// Subscribe delivers values set in caches of all channels, including ones of following starts
+	Subscribe(options SubscribeOptions) Subscription
 }
 
 type bridgeImpl struct {
@@ -23,6 +36,8 @@ type bridgeImpl struct {
 	started    bool
 	mutex      sync.Mutex
 	processors map[string]ChannelProcessor
+	// subscriptions are attached to caches of processors created by following starts
+	subscriptions []*subscription
 }
 
 func CreateBridge(config *model.Config) Bridge {
@@ -43,6 +58,9 @@ func (b *bridgeImpl) Start() {
 	b.processors = make(map[string]ChannelProcessor, 0)
 	for _, chn := range b.config.Channels {
 		b.processors[chn.Title] = CreateProcessor(&chn, b.config)
+		for _, s := range b.subscriptions {
+			b.processors[chn.Title].Cache().attach(s)
+		}
 	}
 	for _, p := range b.processors {
 		p.Start()
@@ -68,13 +86,60 @@ func (b *bridgeImpl) Get(reference string) (*model.Metric, error) {
 	}
 	return p.Cache().Get(reference), err
 }
-func (b *bridgeImpl) Set(reference string, value uint16) error {
+
+// Read returns cached value if it is not older than maxAge, otherwise reads it from the device
+func (b *bridgeImpl) Read(reference string, maxAge time.Duration) (*model.Metric, error) {
+	p, err := b.getProcessor(reference)
+	if err != nil {
+		return nil, err
+	}
+	if m := p.Cache().Get(reference); m != nil && time.Since(m.Timestamp) <= maxAge {
+		return m, nil
+	}
+	return p.Commander().ReadRef(reference)
+}
+func (b *bridgeImpl) Set(reference string, value float64) error {
 	p, err := b.getProcessor(reference)
 	if err != nil {
 		return err
 	}
 	return p.Commander().WriteRef(reference, value)
 }
+func (b *bridgeImpl) SetRaw(reference string, value float64) error {
+	p, err := b.getProcessor(reference)
+	if err != nil {
+		return err
+	}
+	return p.Commander().WriteRaw(reference, value)
+}
+func (b *bridgeImpl) SetMultiple(reference string, values []float64) error {
+	p, err := b.getProcessor(reference)
+	if err != nil {
+		return err
+	}
+	return p.Commander().WriteRefMultiple(reference, values)
+}
+func (b *bridgeImpl) SetRawMultiple(reference string, values []float64) error {
+	p, err := b.getProcessor(reference)
+	if err != nil {
+		return err
+	}
+	return p.Commander().WriteRawMultiple(reference, values)
+}
+func (b *bridgeImpl) SetText(reference string, text string) error {
+	p, err := b.getProcessor(reference)
+	if err != nil {
+		return err
+	}
+	return p.Commander().WriteText(reference, text)
+}
+func (b *bridgeImpl) Passthrough(channel string, slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	p, err := b.getProcessor(channel)
+	if err != nil {
+		return nil, err
+	}
+	return p.Commander().Passthrough(slaveId, request)
+}
 func (b *bridgeImpl) List() []*model.Metric {
 	var result []*model.Metric
 	for _, p := range b.processors {
@@ -106,16 +171,51 @@ func (b *bridgeImpl) Regs() []*model.Register {
 	}
 	return result
 }
+
+// Devices returns availability of all devices, ordered by channel and device title
+func (b *bridgeImpl) Devices() []model.DeviceState {
+	var result []model.DeviceState
+	for _, p := range b.processors {
+		result = append(result, p.Monitor().States()...)
+	}
+	slices.SortFunc(result, func(a, b model.DeviceState) int {
+		return strings.Compare(a.Channel+":"+a.Device, b.Channel+":"+b.Device)
+	})
+	return result
+}
+
+// Channels returns connections in use by the channels, ordered by channel title
+func (b *bridgeImpl) Channels() []model.ChannelState {
+	var result []model.ChannelState
+	for _, p := range b.processors {
+		result = append(result, p.State())
+	}
+	slices.SortFunc(result, func(a, b model.ChannelState) int {
+		return strings.Compare(a.Channel, b.Channel)
+	})
+	return result
+}
 func (b *bridgeImpl) Flush() {
 	for _, p := range b.processors {
 		p.Cache().Flush()
 	}
 }
+func (b *bridgeImpl) Subscribe(options SubscribeOptions) Subscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	s := newSubscription(options)
+	b.subscriptions = slices.DeleteFunc(b.subscriptions, (*subscription).isClosed)
+	b.subscriptions = append(b.subscriptions, s)
+	for _, p := range b.processors {
+		p.Cache().attach(s)
+	}
+	return s
+}
 func (b *bridgeImpl) getProcessor(reference string) (ChannelProcessor, error) {
 	channel := strings.Split(reference, ":")[0]
 	processor, ok := b.processors[channel]
 	if !ok {
-		return nil, fmt.Errorf("could not find processor for %s", reference)
+		return nil, fmt.Errorf("%w: could not find processor for %s", ErrNotFound, reference)
 	}
 	return processor, nil
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"mbridge/model"
 	"slices"
+	"sync"
 	"time"
 )
 
@@ -13,42 +14,96 @@ type MetricCache interface {
 	Set(reference string, value *model.Metric)
 	List() []*model.Metric
 	Flush()
+	// Subscribe delivers values set from now on to the subscriber
+	Subscribe(options SubscribeOptions) Subscription
+	// attach adds a subscription shared with other caches
+	attach(s *subscription)
 }
 
 func CreateMetricCache(ttl time.Duration) MetricCache {
 	return &metricCacheImpl{
 		metrics: make(map[string]*model.Metric, 0),
+		ttls:    make(map[string]time.Duration),
 		ttl:     ttl,
 	}
 }
 
+// CreateChannelCache creates the cache of channel's metrics, which keeps values of registers & their bit
+// fields as long as configured by GetMetricTTL
+func CreateChannelCache(channel *model.Channel, config *model.Config) MetricCache {
+	mc := CreateMetricCache(config.GetTTL()).(*metricCacheImpl)
+	for i := range channel.Devices {
+		d := &channel.Devices[i]
+		for j := range d.Registers {
+			r := &d.Registers[j]
+			ttl, expires := config.GetMetricTTL(r)
+			if !expires {
+				ttl = -1
+			}
+			if ttl == mc.ttl {
+				continue
+			}
+			mc.ttls[model.MetricKey(r)] = ttl
+			for k := range r.Bits {
+				mc.ttls[model.BitMetricKey(r, &r.Bits[k])] = ttl
+			}
+		}
+	}
+	return mc
+}
+
+// metricCacheImpl is written by the executor & read by API handlers, sinks & the Modbus server concurrently
 type metricCacheImpl struct {
-	ttl     time.Duration
-	metrics map[string]*model.Metric
+	ttl time.Duration
+	// ttls are TTLs of metrics which differ from the default one, negative for metrics not expiring
+	ttls          map[string]time.Duration
+	metrics       map[string]*model.Metric
+	subscriptions []*subscription
+	mutex         sync.RWMutex
 }
 
 func (mc *metricCacheImpl) Key(channel *model.Channel, register *model.Register) string {
 	return fmt.Sprintf("%s:%s:%s", channel.Title, register.Device.Title, register.Title)
 }
 func (mc *metricCacheImpl) Get(reference string) *model.Metric {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
 	v, ok := mc.metrics[reference]
 	if !ok {
 		return nil
 	}
-	if v.IsExpired(mc.ttl) {
+	if mc.isExpired(reference, v) {
 		return nil
 	}
 	return v
 }
 func (mc *metricCacheImpl) Set(reference string, value *model.Metric) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	previous := mc.metrics[reference]
 	mc.metrics[reference] = value
+	// closed subscriptions are dropped as they are come across
+	subscriptions := mc.subscriptions[:0]
+	for _, s := range mc.subscriptions {
+		if s.isClosed() {
+			continue
+		}
+		s.offer(Change{Previous: previous, Current: value})
+		subscriptions = append(subscriptions, s)
+	}
+	clear(mc.subscriptions[len(subscriptions):])
+	mc.subscriptions = subscriptions
 }
 func (mc *metricCacheImpl) Flush() {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
 	for k := range mc.metrics {
 		delete(mc.metrics, k)
 	}
 }
 func (mc *metricCacheImpl) List() []*model.Metric {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
 	var keys []string = make([]string, 0)
 	for k, _ := range mc.metrics {
 		keys = append(keys, k)
@@ -57,10 +112,27 @@ func (mc *metricCacheImpl) List() []*model.Metric {
 	var result []*model.Metric
 	for _, k := range keys {
 		m := mc.metrics[k]
-		if m.IsExpired(mc.ttl) {
+		if mc.isExpired(k, m) {
 			continue
 		}
 		result = append(result, m)
 	}
 	return result
 }
+func (mc *metricCacheImpl) isExpired(key string, metric *model.Metric) bool {
+	ttl, ok := mc.ttls[key]
+	if !ok {
+		ttl = mc.ttl
+	}
+	return ttl >= 0 && metric.IsExpired(ttl)
+}
+func (mc *metricCacheImpl) Subscribe(options SubscribeOptions) Subscription {
+	s := newSubscription(options)
+	mc.attach(s)
+	return s
+}
+func (mc *metricCacheImpl) attach(s *subscription) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	mc.subscriptions = append(mc.subscriptions, s)
+}
@@ -0,0 +1,65 @@
+package bridge
+
+import (
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"testing"
+	"time"
+)
+
+func TestChannelCacheTTL(t *testing.T) {
+	config := modeltest.Config(t, `{"ttl": "50ms", "channels": [{"title": "c", "devices": [{"title": "d", "slave_id": 1, "registers": [
+		{"title": "serial", "poll_class": "once"},
+		{"title": "status", "poll_interval": "100ms", "bits": [{"title": "alarm", "bit": 0}]},
+		{"title": "level"}]}]}]}`)
+	cache := CreateChannelCache(&config.Channels[0], config)
+	stored := time.Now().Add(-150 * time.Millisecond)
+	for _, key := range []string{"c:d:serial", "c:d:status", "c:d:status.alarm", "c:d:level"} {
+		cache.Set(key, &model.Metric{Key: key, RawValue: uint16(1), Timestamp: stored})
+	}
+	// values expire after the cache's TTL, but not before two poll intervals, values read once never
+	for key, expected := range map[string]bool{"c:d:serial": true, "c:d:status": true, "c:d:status.alarm": true, "c:d:level": true} {
+		if present := cache.Get(key) != nil; present != expected {
+			t.Errorf("%s: expected present %t, got %t", key, expected, present)
+		}
+	}
+	stored = time.Now().Add(-time.Second - 250*time.Millisecond)
+	for _, key := range []string{"c:d:serial", "c:d:status", "c:d:status.alarm", "c:d:level"} {
+		cache.Set(key, &model.Metric{Key: key, RawValue: uint16(1), Timestamp: stored})
+	}
+	for key, expected := range map[string]bool{"c:d:serial": true, "c:d:status": false, "c:d:status.alarm": false, "c:d:level": true} {
+		if present := cache.Get(key) != nil; present != expected {
+			t.Errorf("%s: expected present %t, got %t", key, expected, present)
+		}
+	}
+	if n := len(cache.List()); n != 2 {
+		t.Errorf("expected 2 listed metrics, got %d", n)
+	}
+}
+
+// TestMetricCacheConcurrent has the executor's writes race with readers of the API, sinks & the Modbus server,
+// which 'go test -race' reports unless the cache guards its metrics
+func TestMetricCacheConcurrent(t *testing.T) {
+	cache := CreateMetricCache(time.Minute)
+	done := make(chan struct{})
+	for range 4 {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for i := range 1000 {
+				cache.Get("c:d:r")
+				if i%100 == 0 {
+					cache.List()
+				}
+			}
+		}()
+	}
+	for i := range 1000 {
+		cache.Set("c:d:r", &model.Metric{Key: "c:d:r", RawValue: uint16(i), Timestamp: time.Now()})
+	}
+	for range 4 {
+		<-done
+	}
+	if m := cache.Get("c:d:r"); nil == m || m.RawValue != uint16(999) {
+		t.Errorf("expected the last value set, got %v", m)
+	}
+}
@@ -0,0 +1,231 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"mbridge/model"
+	"strings"
+)
+
+// decode converts bus data read from a register into a value of the register's data type
+func decode(register *model.Register, buff []byte) (any, error) {
+	if 0 == len(buff) {
+		return nil, errors.New("no value")
+	}
+	if register.IsBit() {
+		return uint16(buff[0]), nil
+	}
+	if register.DataType == model.STRING {
+		return decodeString(register, buff), nil
+	}
+	size := int(register.DataType.Words()) * 2
+	if len(buff) < size {
+		return nil, fmt.Errorf("decode: %d bytes received, %s needs %d: % 0x", len(buff), register.DataType, size, buff)
+	}
+	data := register.ByteOrder.Apply(buff[:size])
+	switch register.DataType {
+	case model.INT16:
+		return int16(binary.BigEndian.Uint16(data)), nil
+	case model.UINT16:
+		return binary.BigEndian.Uint16(data), nil
+	case model.INT32:
+		return int32(binary.BigEndian.Uint32(data)), nil
+	case model.UINT32:
+		return binary.BigEndian.Uint32(data), nil
+	case model.FLOAT32:
+		return math.Float32frombits(binary.BigEndian.Uint32(data)), nil
+	case model.INT64:
+		return int64(binary.BigEndian.Uint64(data)), nil
+	case model.UINT64:
+		return binary.BigEndian.Uint64(data), nil
+	case model.FLOAT64:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	default:
+		return nil, fmt.Errorf("decode: unsupported data type %d", register.DataType)
+	}
+}
+
+// decodeString converts a run of registers into a string, two characters per register
+func decodeString(register *model.Register, buff []byte) string {
+	data := make([]byte, len(buff)-len(buff)%2)
+	copy(data, buff)
+	if register.SwapBytes {
+		for i := 0; i < len(data); i += 2 {
+			data[i], data[i+1] = data[i+1], data[i]
+		}
+	}
+	if register.Trim {
+		return strings.TrimRight(string(data), "\x00 ")
+	}
+	return string(data)
+}
+
+// toUint64 returns the bit pattern of a decoded integer register value
+func toUint64(raw any) (uint64, error) {
+	switch v := raw.(type) {
+	case int16:
+		return uint64(uint16(v)), nil
+	case uint16:
+		return uint64(v), nil
+	case int32:
+		return uint64(uint32(v)), nil
+	case uint32:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("convert: value of type %T is not an integer", raw)
+	}
+}
+
+// fromFloat converts a raw numeric value into the register's data type, checking its range
+func fromFloat(register *model.Register, raw float64) (any, error) {
+	if math.IsNaN(raw) || math.IsInf(raw, 0) {
+		return nil, fmt.Errorf("value %v can not be written", raw)
+	}
+	if register.IsBit() {
+		if raw != 0 {
+			return uint16(1), nil
+		}
+		return uint16(0), nil
+	}
+	v := math.Round(raw)
+	switch register.DataType {
+	case model.INT16:
+		if v < math.MinInt16 || v > math.MaxInt16 {
+			return nil, fmt.Errorf("value %v is out of int16 range", raw)
+		}
+		return int16(v), nil
+	case model.UINT16:
+		if v < 0 || v > math.MaxUint16 {
+			return nil, fmt.Errorf("value %v is out of uint16 range", raw)
+		}
+		return uint16(v), nil
+	case model.INT32:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("value %v is out of int32 range", raw)
+		}
+		return int32(v), nil
+	case model.UINT32:
+		if v < 0 || v > math.MaxUint32 {
+			return nil, fmt.Errorf("value %v is out of uint32 range", raw)
+		}
+		return uint32(v), nil
+	case model.FLOAT32:
+		if math.Abs(raw) > math.MaxFloat32 {
+			return nil, fmt.Errorf("value %v is out of float32 range", raw)
+		}
+		return float32(raw), nil
+	case model.INT64:
+		if v < math.MinInt64 || v >= math.MaxInt64 {
+			return nil, fmt.Errorf("value %v is out of int64 range", raw)
+		}
+		return int64(v), nil
+	case model.UINT64:
+		if v < 0 || v >= math.MaxUint64 {
+			return nil, fmt.Errorf("value %v is out of uint64 range", raw)
+		}
+		return uint64(v), nil
+	case model.FLOAT64:
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("numeric value can not be written to %s register", register.DataType)
+	}
+}
+
+// fromUint64 converts a bit pattern into the register's (integer) data type
+func fromUint64(register *model.Register, bits uint64) (any, error) {
+	switch register.DataType {
+	case model.INT16:
+		return int16(bits), nil
+	case model.UINT16:
+		return uint16(bits), nil
+	case model.INT32:
+		return int32(bits), nil
+	case model.UINT32:
+		return uint32(bits), nil
+	case model.INT64:
+		return int64(bits), nil
+	case model.UINT64:
+		return bits, nil
+	default:
+		return nil, fmt.Errorf("convert: %s is not an integer data type", register.DataType)
+	}
+}
+
+// encode converts a value of the register's data type into bus data
+func encode(register *model.Register, value any) ([]byte, error) {
+	var data []byte
+	switch v := value.(type) {
+	case int16:
+		data = binary.BigEndian.AppendUint16(nil, uint16(v))
+	case uint16:
+		data = binary.BigEndian.AppendUint16(nil, v)
+	case int32:
+		data = binary.BigEndian.AppendUint32(nil, uint32(v))
+	case uint32:
+		data = binary.BigEndian.AppendUint32(nil, v)
+	case float32:
+		data = binary.BigEndian.AppendUint32(nil, math.Float32bits(v))
+	case int64:
+		data = binary.BigEndian.AppendUint64(nil, uint64(v))
+	case uint64:
+		data = binary.BigEndian.AppendUint64(nil, v)
+	case float64:
+		data = binary.BigEndian.AppendUint64(nil, math.Float64bits(v))
+	case string:
+		if register.DataType != model.STRING {
+			return nil, fmt.Errorf("encode: text can not be written to %s register", register.DataType)
+		}
+		return encodeString(register, v)
+	default:
+		return nil, fmt.Errorf("encode: value of type %T can not be written", value)
+	}
+	if len(data) != int(register.DataType.Words())*2 {
+		return nil, fmt.Errorf("encode: value of type %T does not match %s register", value, register.DataType)
+	}
+	return register.ByteOrder.Apply(data), nil
+}
+
+// encodeString converts a string into register's run of words, padding it with NULs
+func encodeString(register *model.Register, text string) ([]byte, error) {
+	if len(text) > int(register.Size)*2 {
+		return nil, fmt.Errorf("encode: text of %d bytes does not fit %d registers", len(text), register.Size)
+	}
+	data := make([]byte, int(register.Size)*2)
+	copy(data, text)
+	if register.SwapBytes {
+		for i := 0; i < len(data); i += 2 {
+			data[i], data[i+1] = data[i+1], data[i]
+		}
+	}
+	return data, nil
+}
+
+// sliceWords cuts count registers starting at the offset (in registers) out of block read data
+func sliceWords(buff []byte, offset, count int) ([]byte, error) {
+	if (offset+count)*2 > len(buff) {
+		return nil, fmt.Errorf("decode: registers %d-%d are out of %d bytes received", offset, offset+count-1, len(buff))
+	}
+	return buff[offset*2 : (offset+count)*2], nil
+}
+
+// sliceBits cuts count bits starting at the offset (in bits) out of block read data,
+// re-packing them the way a read of those bits alone would have returned them
+func sliceBits(buff []byte, offset, count int) ([]byte, error) {
+	if offset+count > len(buff)*8 {
+		return nil, fmt.Errorf("decode: bits %d-%d are out of %d bytes received", offset, offset+count-1, len(buff))
+	}
+	result := make([]byte, (count+7)/8)
+	for i := 0; i < count; i++ {
+		bit := offset + i
+		if buff[bit/8]&(1<<(bit%8)) != 0 {
+			result[i/8] |= 1 << (i % 8)
+		}
+	}
+	return result, nil
+}
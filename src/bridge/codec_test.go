@@ -0,0 +1,115 @@
+package bridge
+
+import (
+	"bytes"
+	"mbridge/model"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		register model.Register
+		buff     []byte
+		exp      any
+	}{
+		{model.Register{Type: model.INPUT, DataType: model.INT16, ByteOrder: model.ABCD}, []byte{0xFF, 0xFE}, int16(-2)},
+		{model.Register{Type: model.INPUT, DataType: model.UINT16, ByteOrder: model.BADC}, []byte{0x34, 0x12}, uint16(0x1234)},
+		{model.Register{Type: model.INPUT, DataType: model.UINT32, ByteOrder: model.ABCD}, []byte{0x00, 0x01, 0x00, 0x02}, uint32(0x00010002)},
+		{model.Register{Type: model.INPUT, DataType: model.INT32, ByteOrder: model.CDAB}, []byte{0xFF, 0xFE, 0xFF, 0xFF}, int32(-2)},
+		{model.Register{Type: model.HOLDING, DataType: model.FLOAT32, ByteOrder: model.CDAB}, []byte{0x00, 0x00, 0x43, 0x66}, float32(230)},
+		{model.Register{Type: model.HOLDING, DataType: model.FLOAT32, ByteOrder: model.DCBA}, []byte{0x00, 0x00, 0x66, 0x43}, float32(230)},
+		{model.Register{Type: model.HOLDING, DataType: model.UINT64, ByteOrder: model.ABCD}, []byte{0, 0, 0, 0, 0, 0, 0x01, 0x00}, uint64(256)},
+		{model.Register{Type: model.HOLDING, DataType: model.FLOAT64, ByteOrder: model.ABCD}, []byte{0x40, 0x09, 0x21, 0xFB, 0x54, 0x44, 0x2D, 0x18}, 3.141592653589793},
+		{model.Register{Type: model.COIL, DataType: model.UINT16}, []byte{0x01}, uint16(1)},
+	}
+	for _, test := range tests {
+		res, err := decode(&test.register, test.buff)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if test.exp != res {
+			t.Errorf("%s: expected '%v' (%T), got '%v' (%T) instead", test.register.DataType, test.exp, test.exp, res, res)
+		}
+	}
+}
+func TestDecodeShortBuffer(t *testing.T) {
+	register := model.Register{Type: model.INPUT, DataType: model.FLOAT32, ByteOrder: model.ABCD}
+	if _, err := decode(&register, []byte{0x01, 0x02}); err == nil {
+		t.Errorf("expected error for short buffer")
+	}
+}
+func TestDecodeString(t *testing.T) {
+	tests := []struct {
+		register model.Register
+		buff     []byte
+		exp      string
+	}{
+		{model.Register{Type: model.HOLDING, DataType: model.STRING, Size: 3, Trim: true}, []byte("SN1234"), "SN1234"},
+		{model.Register{Type: model.HOLDING, DataType: model.STRING, Size: 3, Trim: true}, []byte("v1.2\x00\x00"), "v1.2"},
+		{model.Register{Type: model.HOLDING, DataType: model.STRING, Size: 3, Trim: false}, []byte("v1.2\x00\x00"), "v1.2\x00\x00"},
+		{model.Register{Type: model.HOLDING, DataType: model.STRING, Size: 3, Trim: true, SwapBytes: true}, []byte("NS2143"), "SN1234"},
+	}
+	for _, test := range tests {
+		res, err := decode(&test.register, test.buff)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if test.exp != res {
+			t.Errorf("expected %q, got %q instead", test.exp, res)
+		}
+	}
+}
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		register model.Register
+		raw      float64
+		exp      []byte
+	}{
+		{model.Register{Type: model.HOLDING, DataType: model.INT16, ByteOrder: model.ABCD}, -2, []byte{0xFF, 0xFE}},
+		{model.Register{Type: model.HOLDING, DataType: model.UINT16, ByteOrder: model.ABCD}, 224.6, []byte{0x00, 0xE1}},
+		{model.Register{Type: model.HOLDING, DataType: model.UINT32, ByteOrder: model.CDAB}, 0x00010002, []byte{0x00, 0x02, 0x00, 0x01}},
+		{model.Register{Type: model.HOLDING, DataType: model.FLOAT32, ByteOrder: model.CDAB}, 230, []byte{0x00, 0x00, 0x43, 0x66}},
+		{model.Register{Type: model.HOLDING, DataType: model.FLOAT64, ByteOrder: model.ABCD}, 3.141592653589793, []byte{0x40, 0x09, 0x21, 0xFB, 0x54, 0x44, 0x2D, 0x18}},
+	}
+	for _, test := range tests {
+		value, err := fromFloat(&test.register, test.raw)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		res, err := encode(&test.register, value)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if !bytes.Equal(test.exp, res) {
+			t.Errorf("%s: expected '% x', got '% x' instead", test.register.DataType, test.exp, res)
+		}
+		back, err := decode(&test.register, res)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if back != value {
+			t.Errorf("%s: expected '%v' after round trip, got '%v' instead", test.register.DataType, value, back)
+		}
+	}
+}
+func TestEncodeOutOfRange(t *testing.T) {
+	register := model.Register{Type: model.HOLDING, DataType: model.UINT16, ByteOrder: model.ABCD}
+	for _, raw := range []float64{-1, 65536} {
+		if _, err := fromFloat(&register, raw); err == nil {
+			t.Errorf("expected error for %v", raw)
+		}
+	}
+}
+func TestEncodeString(t *testing.T) {
+	register := model.Register{Type: model.HOLDING, DataType: model.STRING, Size: 3, SwapBytes: true}
+	res, err := encode(&register, "SN12")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := []byte("NS21\x00\x00"); !bytes.Equal(exp, res) {
+		t.Errorf("expected '% x', got '% x' instead", exp, res)
+	}
+	if _, err := encode(&register, "SN1234567"); err == nil {
+		t.Errorf("expected error for too long text")
+	}
+}
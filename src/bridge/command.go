@@ -1,12 +1,19 @@
 package bridge
 
-import "mbridge/model"
+import (
+	"fmt"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"sync/atomic"
+)
 
 type Type int
 
 const (
 	CTRead Type = iota
 	CTWrite
+	// CTRaw commands carry a request PDU passed through to the device as is
+	CTRaw
 )
 
 type Command interface {
@@ -14,22 +21,90 @@ type Command interface {
 	GetChannel() *model.Channel
 	GetDevice() *model.Device
 	GetRegister() *model.Register
-	GetValue() uint16
+	GetRegisters() []*model.Register
+	GetBitField() *model.BitField
+	GetValue() any
+	// Complete reports the outcome of the command's execution; it never blocks
+	Complete(result Result)
+	// Done delivers the outcome of the command's execution
+	Done() <-chan Result
+	// Cancel withdraws the command if its execution has not begun yet, which it reports
+	Cancel() bool
+	// Begin marks the command as being executed, unless it has been cancelled
+	Begin() bool
+}
+
+// Result is the outcome of a command's execution reported back by the executor
+type Result struct {
+	Metrics []*model.Metric
+	// Response is device's answer to a raw command, which may be an exception
+	Response *modbus.ProtocolDataUnit
+	Err      error
+}
+
+const (
+	statePending int32 = iota
+	stateExecuting
+	stateCancelled
+)
+
+type completion struct {
+	done  chan Result
+	state *atomic.Int32
+}
+
+func newCompletion() completion {
+	return completion{done: make(chan Result, 1), state: new(atomic.Int32)}
+}
+func (c *completion) Complete(result Result) {
+	select {
+	case c.done <- result:
+	default:
+	}
+}
+func (c *completion) Done() <-chan Result {
+	return c.done
+}
+func (c *completion) Cancel() bool {
+	return c.state.CompareAndSwap(statePending, stateCancelled)
+}
+func (c *completion) Begin() bool {
+	return c.state.CompareAndSwap(statePending, stateExecuting)
+}
+
+// describe names the command's target for logging
+func describe(cmd Command) string {
+	if cmd.GetRegister() == nil {
+		return fmt.Sprintf("%s:%s", cmd.GetChannel().Title, cmd.GetDevice().Title)
+	}
+	return model.MetricKey(cmd.GetRegister())
 }
 
 // region - read command
 
 type readCommand struct {
-	channel  *model.Channel
-	device   *model.Device
-	register *model.Register
+	completion
+	channel   *model.Channel
+	device    *model.Device
+	registers []*model.Register
 }
 
 func NewReadCommand(channel *model.Channel, device *model.Device, register *model.Register) Command {
 	return &readCommand{
-		channel:  channel,
-		device:   device,
-		register: register,
+		completion: newCompletion(),
+		channel:    channel,
+		device:     device,
+		registers:  []*model.Register{register},
+	}
+}
+
+// NewBlockReadCommand creates a command reading all registers (of the same slave and type) with a single request
+func NewBlockReadCommand(channel *model.Channel, device *model.Device, registers []*model.Register) Command {
+	return &readCommand{
+		completion: newCompletion(),
+		channel:    channel,
+		device:     device,
+		registers:  registers,
 	}
 }
 
@@ -43,28 +118,50 @@ func (c *readCommand) GetDevice() *model.Device {
 	return c.device
 }
 func (c *readCommand) GetRegister() *model.Register {
-	return c.register
+	return c.registers[0]
 }
-func (c *readCommand) GetValue() uint16 {
-	return 0
+func (c *readCommand) GetRegisters() []*model.Register {
+	return c.registers
+}
+func (c *readCommand) GetBitField() *model.BitField {
+	return nil
+}
+func (c *readCommand) GetValue() any {
+	return nil
 }
 
 // endregion
 // region - write command
 
 type writeCommand struct {
+	completion
 	channel  *model.Channel
 	device   *model.Device
 	register *model.Register
-	value    uint16
+	bitField *model.BitField
+	value    any
 }
 
-func NewWriteCommand(channel *model.Channel, device *model.Device, register *model.Register, value uint16) Command {
+// NewWriteCommand creates a command writing the value, which must be of the register's data type
+func NewWriteCommand(channel *model.Channel, device *model.Device, register *model.Register, value any) Command {
 	return &writeCommand{
-		channel:  channel,
-		device:   device,
-		register: register,
-		value:    value,
+		completion: newCompletion(),
+		channel:    channel,
+		device:     device,
+		register:   register,
+		value:      value,
+	}
+}
+
+// NewBitWriteCommand creates a command replacing a bit field of the register with the value
+func NewBitWriteCommand(channel *model.Channel, device *model.Device, register *model.Register, bitField *model.BitField, value uint64) Command {
+	return &writeCommand{
+		completion: newCompletion(),
+		channel:    channel,
+		device:     device,
+		register:   register,
+		bitField:   bitField,
+		value:      value,
 	}
 }
 
@@ -80,8 +177,56 @@ func (c *writeCommand) GetDevice() *model.Device {
 func (c *writeCommand) GetRegister() *model.Register {
 	return c.register
 }
-func (c *writeCommand) GetValue() uint16 {
+func (c *writeCommand) GetRegisters() []*model.Register {
+	return []*model.Register{c.register}
+}
+func (c *writeCommand) GetBitField() *model.BitField {
+	return c.bitField
+}
+func (c *writeCommand) GetValue() any {
 	return c.value
 }
 
 // endregion
+// region - raw command
+
+type rawCommand struct {
+	completion
+	channel *model.Channel
+	device  *model.Device
+	request *modbus.ProtocolDataUnit
+}
+
+// NewRawCommand creates a command sending the request PDU to the device, regardless of configured registers
+func NewRawCommand(channel *model.Channel, device *model.Device, request *modbus.ProtocolDataUnit) Command {
+	return &rawCommand{
+		completion: newCompletion(),
+		channel:    channel,
+		device:     device,
+		request:    request,
+	}
+}
+
+func (c *rawCommand) GetType() Type {
+	return CTRaw
+}
+func (c *rawCommand) GetChannel() *model.Channel {
+	return c.channel
+}
+func (c *rawCommand) GetDevice() *model.Device {
+	return c.device
+}
+func (c *rawCommand) GetRegister() *model.Register {
+	return nil
+}
+func (c *rawCommand) GetRegisters() []*model.Register {
+	return nil
+}
+func (c *rawCommand) GetBitField() *model.BitField {
+	return nil
+}
+func (c *rawCommand) GetValue() any {
+	return c.request
+}
+
+// endregion
@@ -1,39 +1,222 @@
 package bridge
 
 import (
+	"errors"
+	"fmt"
+	"github.com/mvkvl/modbus"
+	"math"
 	"mbridge/model"
 	"mbridge/util"
+	"sync"
+	"time"
 )
 
 type Commander interface {
-	WriteRef(reference string, value uint16) error
+	// WriteRef writes engineering value, converting it back through the register's inverse transform (or factor)
+	WriteRef(reference string, value float64) error
+	// WriteRaw writes raw register value, converting it to the register's data type only
+	WriteRaw(reference string, value float64) error
+	// WriteRefMultiple writes a block of engineering values starting at the register's address in one request
+	WriteRefMultiple(reference string, values []float64) error
+	// WriteRawMultiple writes a block of raw values starting at the register's address in one request
+	WriteRawMultiple(reference string, values []float64) error
+	// WriteText writes a string to a string register
+	WriteText(reference string, text string) error
+	// ReadRef reads register (or bit field) value from the device, bypassing the poller
+	ReadRef(reference string) (*model.Metric, error)
+	// Passthrough sends the request PDU to the slave as is, queued with on-demand reads; device's
+	// exception responses are returned as the response, not as an error
+	Passthrough(slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error)
 }
 
 type commanderImpl struct {
 	channel     *model.Channel
 	config      *model.Config
 	writeCmdChn chan<- Command
+	queryCmdChn chan<- Command
 	quitChn     chan struct{}
 	logger      util.Logger
+	// devices stands for slaves passed through to which are not configured on the channel
+	devices map[uint8]*model.Device
+	mutex   sync.Mutex
 }
 
-func CreateCommander(writeCmdChn chan Command, channel *model.Channel, config *model.Config) Commander {
+func CreateCommander(writeCmdChn, queryCmdChn chan Command, channel *model.Channel, config *model.Config) Commander {
 	return &commanderImpl{
 		channel:     channel,
 		config:      config,
 		writeCmdChn: writeCmdChn,
+		queryCmdChn: queryCmdChn,
 		quitChn:     make(chan struct{}),
 		logger:      util.GetLogger("commander"),
+		devices:     make(map[uint8]*model.Device),
 	}
 }
 
-func (p *commanderImpl) WriteRef(reference string, value uint16) error {
+func (p *commanderImpl) WriteRef(reference string, value float64) error {
 	reg, err := p.config.FindRegister(reference)
+	if err != nil {
+		// bit fields have no transform, their value is written as is
+		return p.WriteRaw(reference, value)
+	}
+	raw, err := reg.ToRaw(value)
 	if err != nil {
 		return err
 	}
-	cmd := NewWriteCommand(p.channel, reg.Device, reg, value)
+	return p.WriteRaw(reference, raw)
+}
+func (p *commanderImpl) WriteRaw(reference string, value float64) error {
+	var cmd Command
+	reg, err := p.config.FindRegister(reference)
+	if err != nil {
+		r, b, e := p.config.FindBitField(reference)
+		if e != nil {
+			return fmt.Errorf("%w: %v", ErrNotFound, err)
+		}
+		if value < 0 || value != math.Trunc(value) {
+			return fmt.Errorf("invalid bit field value: %v", value)
+		}
+		cmd = NewBitWriteCommand(p.channel, r.Device, r, b, uint64(value))
+	} else {
+		v, err := fromFloat(reg, value)
+		if err != nil {
+			return err
+		}
+		cmd = NewWriteCommand(p.channel, reg.Device, reg, v)
+	}
+	if cmd.GetBitField() != nil && cmd.GetRegister().Type != model.HOLDING {
+		return errors.New("bit fields can only be written to holding registers")
+	}
+	return p.send(cmd)
+}
+func (p *commanderImpl) WriteRefMultiple(reference string, values []float64) error {
+	reg, err := p.config.FindRegister(reference)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	raw := make([]float64, len(values))
+	for i, v := range values {
+		if raw[i], err = reg.ToRaw(v); err != nil {
+			return err
+		}
+	}
+	return p.WriteRawMultiple(reference, raw)
+}
+func (p *commanderImpl) WriteRawMultiple(reference string, values []float64) error {
+	reg, err := p.config.FindRegister(reference)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	block := make([]any, len(values))
+	for i, v := range values {
+		if block[i], err = fromFloat(reg, v); err != nil {
+			return err
+		}
+	}
+	return p.send(NewWriteCommand(p.channel, reg.Device, reg, block))
+}
+func (p *commanderImpl) WriteText(reference string, text string) error {
+	reg, err := p.config.FindRegister(reference)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	if reg.DataType != model.STRING {
+		return fmt.Errorf("text can not be written to %s register", reg.DataType)
+	}
+	return p.send(NewWriteCommand(p.channel, reg.Device, reg, text))
+}
+
+func (p *commanderImpl) send(cmd Command) error {
+	if cmd.GetRegister().Mode == model.RO {
+		return errors.New("trying to write to read only register")
+	}
+	if cmd.GetRegister().Type != model.COIL && cmd.GetRegister().Type != model.HOLDING {
+		return fmt.Errorf("%s registers can not be written", cmd.GetRegister().Type)
+	}
 	p.logger.Trace("writing register: %s:%s:%s", cmd.GetChannel().Title, cmd.GetDevice().Title, cmd.GetRegister().Title)
-	p.writeCmdChn <- cmd
-	return nil
+	_, err := p.execute(p.writeCmdChn, cmd, p.channel.GetWriteTimeout())
+	return err
+}
+func (p *commanderImpl) ReadRef(reference string) (*model.Metric, error) {
+	var key string
+	reg, err := p.config.FindRegister(reference)
+	if err == nil {
+		key = model.MetricKey(reg)
+	} else {
+		r, b, e := p.config.FindBitField(reference)
+		if e != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+		}
+		reg, key = r, model.BitMetricKey(r, b)
+	}
+	cmd := NewReadCommand(p.channel, reg.Device, reg)
+	p.logger.Trace("reading register: %s:%s:%s", cmd.GetChannel().Title, cmd.GetDevice().Title, cmd.GetRegister().Title)
+	result, err := p.execute(p.queryCmdChn, cmd, p.channel.GetReadTimeout())
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range result.Metrics {
+		if m.Key == key {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no value read for %s", ErrDevice, reference)
+}
+
+func (p *commanderImpl) Passthrough(slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	cmd := NewRawCommand(p.channel, p.device(slaveId), request)
+	p.logger.Trace("passing function %d through to %s", request.FunctionCode, describe(cmd))
+	result, err := p.execute(p.queryCmdChn, cmd, p.channel.GetReadTimeout())
+	if err != nil {
+		return nil, err
+	}
+	return result.Response, nil
+}
+
+// device returns channel's device with the slave id, or a stand-in with channel's timing for an unknown slave
+func (p *commanderImpl) device(slaveId uint8) *model.Device {
+	for i := range p.channel.Devices {
+		if p.channel.Devices[i].SlaveId == slaveId {
+			return &p.channel.Devices[i]
+		}
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	d, ok := p.devices[slaveId]
+	if !ok {
+		d = &model.Device{Channel: p.channel, SlaveId: slaveId, Title: fmt.Sprintf("slave-%d", slaveId)}
+		p.devices[slaveId] = d
+	}
+	return d
+}
+
+// execute queues the command & waits for the executor to report its outcome; a command which times out
+// is cancelled, so that it is not executed later, unless its execution has already begun, whose outcome
+// is awaited then
+func (p *commanderImpl) execute(queue chan<- Command, cmd Command, timeout time.Duration) (Result, error) {
+	deadline := time.After(timeout)
+	select {
+	case queue <- cmd:
+	case <-deadline:
+		return Result{}, ErrTimeout
+	}
+	select {
+	case <-deadline:
+		if cmd.Cancel() {
+			return Result{}, ErrTimeout
+		}
+		p.logger.Debug("command for %s is being executed, waiting for it after the timeout", describe(cmd))
+	case result := <-cmd.Done():
+		return p.outcome(result)
+	}
+	return p.outcome(<-cmd.Done())
+}
+func (p *commanderImpl) outcome(result Result) (Result, error) {
+	if errors.Is(result.Err, ErrQueueFull) || errors.Is(result.Err, ErrStopped) {
+		return result, result.Err
+	}
+	if result.Err != nil {
+		return result, fmt.Errorf("%w: %w", ErrDevice, result.Err)
+	}
+	return result, nil
 }
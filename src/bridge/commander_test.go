@@ -0,0 +1,94 @@
+package bridge
+
+import (
+	"errors"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"testing"
+	"time"
+)
+
+func TestCommanderWriteResult(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "write_timeout": "100ms", "devices": [{"title": "d", "slave_id": 1,
+		"registers": [{"title": "setpoint", "type": "holding", "factor": 0.1}]}]}]}`)
+	writeCmdChn := make(chan Command)
+	commander := CreateCommander(writeCmdChn, make(chan Command), &config.Channels[0], config)
+
+	go func() {
+		cmd := <-writeCmdChn
+		if v := cmd.GetValue(); uint16(225) != v {
+			t.Errorf("expected raw value '225', got '%v' instead", v)
+		}
+		cmd.Complete(Result{Err: &modbus.ModbusError{FunctionCode: 6, ExceptionCode: modbus.ExceptionCodeIllegalDataValue}})
+	}()
+	err := commander.WriteRef("c:d:setpoint", 22.5)
+	if !errors.Is(err, ErrDevice) {
+		t.Fatalf("expected device error, got '%v' instead", err)
+	}
+	if code, ok := ExceptionCode(err); !ok || modbus.ExceptionCodeIllegalDataValue != code {
+		t.Errorf("expected exception code %d, got %d instead", modbus.ExceptionCodeIllegalDataValue, code)
+	}
+
+	go func() {
+		(<-writeCmdChn).Complete(Result{})
+	}()
+	if err := commander.WriteRef("c:d:setpoint", 22.5); err != nil {
+		t.Errorf("expected no error, got '%v' instead", err)
+	}
+}
+func TestCommanderWriteTimeout(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "write_timeout": "50ms", "devices": [{"title": "d", "slave_id": 1,
+		"registers": [{"title": "setpoint", "type": "holding"}]}]}]}`)
+	writeCmdChn := make(chan Command, 1)
+	commander := CreateCommander(writeCmdChn, make(chan Command), &config.Channels[0], config)
+	start := time.Now()
+	if err := commander.WriteRef("c:d:setpoint", 1); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected timeout, got '%v' instead", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("write did not time out in time")
+	}
+	// the timed out write is withdrawn, so that the executor does not write it later
+	if cmd := <-writeCmdChn; cmd.Begin() {
+		t.Error("expected timed out write to be cancelled")
+	}
+
+	// a write being executed at the timeout is awaited
+	go func() {
+		cmd := <-writeCmdChn
+		cmd.Begin()
+		time.Sleep(100 * time.Millisecond)
+		cmd.Complete(Result{})
+	}()
+	if err := commander.WriteRef("c:d:setpoint", 1); err != nil {
+		t.Errorf("expected write executed after the timeout to succeed, got '%v' instead", err)
+	}
+	if err := commander.WriteRef("c:d:missing", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got '%v' instead", err)
+	}
+}
+func TestCommanderReadRef(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "read_timeout": "100ms", "devices": [{"title": "d", "slave_id": 1,
+		"registers": [{"title": "status", "type": "holding", "mode": "wo", "bits": [{"title": "alarm", "bit": 3}]}]}]}]}`)
+	queryCmdChn := make(chan Command)
+	commander := CreateCommander(make(chan Command), queryCmdChn, &config.Channels[0], config)
+
+	go func() {
+		cmd := <-queryCmdChn
+		if CTRead != cmd.GetType() || "status" != cmd.GetRegister().Title {
+			t.Errorf("unexpected command: %v", cmd)
+		}
+		cmd.Complete(Result{Metrics: []*model.Metric{
+			{Key: "c:d:status", Value: 8},
+			{Key: "c:d:status.alarm", Value: 1},
+		}})
+	}()
+	m, err := commander.ReadRef("c:d:status.alarm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if "c:d:status.alarm" != m.Key || 1 != m.Value {
+		t.Errorf("unexpected metric: %s", m)
+	}
+}
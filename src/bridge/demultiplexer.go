@@ -1,6 +1,7 @@
 package bridge
 
 import (
+	"mbridge/model"
 	"mbridge/util"
 	"sync"
 )
@@ -10,23 +11,55 @@ type Demultiplexer interface {
 	Stop(title string)
 }
 
+// Priority is a demultiplexer queue level; lower values are sent to the bus first
+type Priority int
+
+const (
+	PriorityWrite Priority = iota
+	PriorityQuery
+	PriorityPoll
+	priorityLevels
+)
+
+var priorityName = map[Priority]string{
+	PriorityWrite: "write",
+	PriorityQuery: "on-demand read",
+	PriorityPoll:  "read",
+}
+
+func (p Priority) String() string {
+	return priorityName[p]
+}
+
+// demultiplexerImpl passes commands to the executor by priority: writes first, then on-demand
+// reads, then background polling; a non-empty level passed over max skip times in a row is
+// served next regardless of priority, so background polling can not starve
 type demultiplexerImpl struct {
-	readCmdChn  <-chan Command
-	writeCmdChn <-chan Command
-	modbusChn   chan<- Command
-	quitChn     chan struct{}
-	logger      util.Logger
-	started     bool
-	mutex       sync.Mutex
+	inputs    [priorityLevels]<-chan Command
+	queues    [priorityLevels][]Command
+	depths    [priorityLevels]int
+	skipped   [priorityLevels]int
+	maxSkip   int
+	modbusChn chan<- Command
+	quitChn   chan struct{}
+	logger    util.Logger
+	started   bool
+	mutex     sync.Mutex
 }
 
-func CreateDemultiplexer(readCmdChn, writeCmdChn, modbusChn chan Command) Demultiplexer {
-	return &demultiplexerImpl{
-		readCmdChn:  readCmdChn,
-		writeCmdChn: writeCmdChn,
-		modbusChn:   modbusChn,
-		logger:      util.GetLogger("demux"),
+func CreateDemultiplexer(readCmdChn, queryCmdChn, writeCmdChn, modbusChn chan Command, channel *model.Channel) Demultiplexer {
+	d := &demultiplexerImpl{
+		maxSkip:   channel.GetQueueMaxSkip(),
+		modbusChn: modbusChn,
+		logger:    util.GetLogger("demux"),
 	}
+	d.inputs[PriorityWrite] = writeCmdChn
+	d.inputs[PriorityQuery] = queryCmdChn
+	d.inputs[PriorityPoll] = readCmdChn
+	d.depths[PriorityWrite] = channel.GetWriteQueueDepth()
+	d.depths[PriorityQuery] = channel.GetQueryQueueDepth()
+	d.depths[PriorityPoll] = channel.GetPollQueueDepth()
+	return d
 }
 
 func (d *demultiplexerImpl) Start(title string) {
@@ -41,26 +74,41 @@ func (d *demultiplexerImpl) Start(title string) {
 	go func() {
 		d.logger.Info("start demultiplexer %s", title)
 		defer func() {
+			d.drain()
 			close(d.modbusChn)
 			close(d.quitChn)
 			d.logger.Info("shutdown demultiplexer %s", title)
 		}()
 		for {
+			// output is a nil channel (never ready) while there is nothing to send
+			var output chan<- Command
+			level, next := d.next()
+			if next != nil {
+				output = d.modbusChn
+			}
+			// background polling is not received while its queue is full, which blocks the poller
+			pollInput := d.inputs[PriorityPoll]
+			if len(d.queues[PriorityPoll]) >= d.depths[PriorityPoll] {
+				pollInput = nil
+			}
 			select {
-			case cmd, ok := <-d.writeCmdChn:
+			case output <- next:
+				d.logger.Trace("multiplexing %s command: %v", level, describe(next))
+				d.pop(level)
+			case cmd, ok := <-d.inputs[PriorityWrite]:
+				if ok {
+					d.push(PriorityWrite, cmd)
+				}
+			case cmd, ok := <-d.inputs[PriorityQuery]:
 				if ok {
-					d.logger.Trace("multiplexing write command: %v", cmd.GetRegister().Title)
-					d.modbusChn <- cmd
+					d.push(PriorityQuery, cmd)
 				}
-			case cmd, ok := <-d.readCmdChn:
+			case cmd, ok := <-pollInput:
 				if ok {
-					d.logger.Trace("multiplexing read command: %v", cmd.GetRegister().Title)
-					d.modbusChn <- cmd
+					d.push(PriorityPoll, cmd)
 				}
 			case <-d.quitChn:
 				return
-				//default:
-				//	time.Sleep(delay)
 			}
 		}
 	}()
@@ -75,3 +123,50 @@ func (d *demultiplexerImpl) Stop(title string) {
 	d.logger.Info("stop demultiplexer %s", title)
 	d.quitChn <- struct{}{}
 }
+
+// push queues the command, rejecting it if its level's queue is full
+func (d *demultiplexerImpl) push(level Priority, cmd Command) {
+	if len(d.queues[level]) >= d.depths[level] {
+		d.logger.Warning("%s queue is full (%d), rejecting command for %s", level, d.depths[level], describe(cmd))
+		cmd.Complete(Result{Err: ErrQueueFull})
+		return
+	}
+	d.queues[level] = append(d.queues[level], cmd)
+}
+
+// next returns the command to be sent to the bus next along with its level
+func (d *demultiplexerImpl) next() (Priority, Command) {
+	for level := priorityLevels - 1; level >= 0; level-- {
+		if len(d.queues[level]) > 0 && d.skipped[level] >= d.maxSkip {
+			return level, d.queues[level][0]
+		}
+	}
+	for level := Priority(0); level < priorityLevels; level++ {
+		if len(d.queues[level]) > 0 {
+			return level, d.queues[level][0]
+		}
+	}
+	return 0, nil
+}
+
+// pop removes the sent command from its queue, counting the skip for the other waiting levels
+func (d *demultiplexerImpl) pop(level Priority) {
+	d.queues[level][0] = nil
+	d.queues[level] = d.queues[level][1:]
+	d.skipped[level] = 0
+	for l := Priority(0); l < priorityLevels; l++ {
+		if l != level && len(d.queues[l]) > 0 {
+			d.skipped[l]++
+		}
+	}
+}
+
+// drain fails commands left in queues on shutdown, so no caller keeps waiting for them
+func (d *demultiplexerImpl) drain() {
+	for level := range d.queues {
+		for _, cmd := range d.queues[level] {
+			cmd.Complete(Result{Err: ErrStopped})
+		}
+		d.queues[level] = nil
+	}
+}
@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"errors"
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"testing"
+	"time"
+)
+
+func testCommands(config *model.Config, count int) []Command {
+	register := &config.Channels[0].Devices[0].Registers[0]
+	commands := make([]Command, count)
+	for i := range commands {
+		commands[i] = NewReadCommand(register.Device.Channel, register.Device, register)
+	}
+	return commands
+}
+func TestDemultiplexerPriority(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "queue": {"max_skip": 2}, "devices": [{"title": "d", "slave_id": 1,
+		"registers": [{"title": "r", "type": "holding"}]}]}]}`)
+	readCmdChn, queryCmdChn, writeCmdChn := make(chan Command), make(chan Command), make(chan Command)
+	modbusChn := make(chan Command)
+	demux := CreateDemultiplexer(readCmdChn, queryCmdChn, writeCmdChn, modbusChn, &config.Channels[0])
+	demux.Start("c")
+	defer demux.Stop("c")
+
+	names := make(map[Command]string)
+	reads, writes := testCommands(config, 2), testCommands(config, 4)
+	for i, cmd := range reads {
+		names[cmd] = "r" + string(rune('0'+i))
+		readCmdChn <- cmd
+	}
+	for i, cmd := range writes {
+		names[cmd] = "w" + string(rune('0'+i))
+		writeCmdChn <- cmd
+	}
+	// writes go first, but a poll is let through after every two of them
+	var order string
+	for range len(reads) + len(writes) {
+		select {
+		case cmd := <-modbusChn:
+			order += names[cmd] + " "
+		case <-time.After(time.Second):
+			t.Fatalf("timed out, got '%s'", order)
+		}
+	}
+	if expected := "w0 w1 r0 w2 w3 r1 "; expected != order {
+		t.Errorf("expected order '%s', got '%s' instead", expected, order)
+	}
+}
+func TestDemultiplexerQueueFull(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "queue": {"write_depth": 1}, "devices": [{"title": "d", "slave_id": 1,
+		"registers": [{"title": "r", "type": "holding"}]}]}]}`)
+	writeCmdChn := make(chan Command)
+	demux := CreateDemultiplexer(make(chan Command), make(chan Command), writeCmdChn, make(chan Command), &config.Channels[0])
+	demux.Start("c")
+
+	writes := testCommands(config, 2)
+	writeCmdChn <- writes[0]
+	writeCmdChn <- writes[1]
+	select {
+	case result := <-writes[1].Done():
+		if !errors.Is(result.Err, ErrQueueFull) {
+			t.Errorf("expected queue full error, got '%v' instead", result.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("rejected command was not completed")
+	}
+	demux.Stop("c")
+	select {
+	case result := <-writes[0].Done():
+		if !errors.Is(result.Err, ErrStopped) {
+			t.Errorf("expected stopped error, got '%v' instead", result.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued command was not completed on stop")
+	}
+}
@@ -0,0 +1,70 @@
+package bridge
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/goburrow/serial"
+	"github.com/mvkvl/modbus"
+	"io"
+	"net"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrNotFound is returned for references which do not resolve to a configured register
+	ErrNotFound = errors.New("not found")
+	// ErrDevice wraps errors of a command's execution on the bus
+	ErrDevice = errors.New("device error")
+	// ErrTimeout is returned when the executor does not report a command's outcome in time
+	ErrTimeout = errors.New("timed out waiting for command result")
+	// ErrQueueFull is returned when too many commands of the same priority wait for the bus
+	ErrQueueFull = errors.New("command queue is full")
+	// ErrStopped is returned for commands still queued when the channel is stopped
+	ErrStopped = errors.New("channel stopped")
+)
+
+// ExceptionCode returns the Modbus exception code the device answered the command with, if any
+func ExceptionCode(err error) (byte, bool) {
+	var modbusError *modbus.ModbusError
+	if errors.As(err, &modbusError) {
+		return modbusError.ExceptionCode, true
+	}
+	return 0, false
+}
+
+// IsDeviceTimeout reports whether the device did not answer in time
+func IsDeviceTimeout(err error) bool {
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+	return errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, serial.ErrTimeout)
+}
+
+// IsUnreachable reports whether the command failed because the device could not be talked to:
+// it did not answer, the connection to it failed or was dropped
+func IsUnreachable(err error) bool {
+	var opError *net.OpError
+	if errors.As(err, &opError) {
+		return true
+	}
+	return IsDeviceTimeout(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// IsConnectionFailure reports whether the connection itself failed: it could not be established,
+// its TLS handshake failed or it was dropped; a device not answering in time over a working
+// connection is not a failure of the connection
+func IsConnectionFailure(err error) bool {
+	var opError *net.OpError
+	if errors.As(err, &opError) && (opError.Op == "dial" || !opError.Timeout()) {
+		return true
+	}
+	var recordError tls.RecordHeaderError
+	var alertError tls.AlertError
+	var verificationError *tls.CertificateVerificationError
+	if errors.As(err, &recordError) || errors.As(err, &alertError) || errors.As(err, &verificationError) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
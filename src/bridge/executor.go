@@ -1,6 +1,8 @@
 package bridge
 
 import (
+	"fmt"
+	"github.com/mvkvl/modbus"
 	"mbridge/model"
 	"mbridge/util"
 	"sync"
@@ -20,16 +22,22 @@ type executorImpl struct {
 	logger       util.Logger
 	modbusClient ModbusClient
 	cache        MetricCache
-	started      bool
-	mutex        sync.Mutex
+	monitor      DeviceMonitor
+	// split are blocks a device answered with an exception, their registers are read one by one;
+	// they are only used by the executing goroutine
+	split   map[string]bool
+	started bool
+	mutex   sync.Mutex
 }
 
-func CreateExecutor(modbusChn chan Command, modbusClient ModbusClient, cache MetricCache) Executor {
+func CreateExecutor(modbusChn chan Command, modbusClient ModbusClient, cache MetricCache, monitor DeviceMonitor) Executor {
 	return &executorImpl{
 		modbusChn:    modbusChn,
 		logger:       util.GetLogger("executor"),
 		modbusClient: modbusClient,
 		cache:        cache,
+		monitor:      monitor,
+		split:        make(map[string]bool),
 	}
 }
 
@@ -73,36 +81,185 @@ func (e *executorImpl) Stop(title string) {
 	e.quitChn <- struct{}{}
 }
 
+// handleCommand executes the command with device's timeout, repeating it while the device
+// does not answer and retries are left, and reports the outcome to the command's sender;
+// a command its sender has given up on is skipped
 func (e *executorImpl) handleCommand(cmd Command) {
+	if !cmd.Begin() {
+		e.logger.Debug("skipping cancelled command for %s", describe(cmd))
+		return
+	}
+	device := cmd.GetDevice()
+	e.modbusClient.SetTimeout(device.GetTimeout())
+	// passed through requests may not be idempotent, the tool sending them decides on repeating them
+	retries := device.GetRetries()
+	if cmd.GetType() == CTRaw {
+		retries = 0
+	}
+	var result Result
+	for attempt := 0; ; attempt++ {
+		result = e.execute(cmd)
+		if result.Err == nil || !IsUnreachable(result.Err) || attempt >= retries {
+			break
+		}
+		e.logger.Debug("retrying command for %s (%d/%d): %v", describe(cmd), attempt+1, retries, result.Err)
+		time.Sleep(device.GetRetryDelay())
+	}
+	e.monitor.Report(device, result.Err)
+	if cmd.GetType() == CTWrite && result.Err != nil {
+		e.logger.Warning("write error: %s: %v", describe(cmd), result.Err)
+	}
+	cmd.Complete(result)
+	if cmd.GetType() == CTWrite {
+		// some devices need time to process a write before they can answer the next request
+		time.Sleep(device.GetTurnaroundDelay())
+	}
+}
+func (e *executorImpl) execute(cmd Command) Result {
 	switch cmd.GetType() {
 	case CTRead:
-		e.readRegister(cmd)
+		metrics, err := e.readRegister(cmd)
+		return Result{Metrics: metrics, Err: err}
 	case CTWrite:
-		e.writeRegister(cmd)
+		return Result{Err: e.writeRegister(cmd)}
+	case CTRaw:
+		response, err := e.modbusClient.Send(cmd.GetDevice().SlaveId, cmd.GetValue().(*modbus.ProtocolDataUnit))
+		return Result{Response: response, Err: err}
 	}
+	return Result{Err: fmt.Errorf("unknown command type: %v", cmd.GetType())}
 }
 
-func (e *executorImpl) readRegister(cmd Command) {
+func (e *executorImpl) readRegister(cmd Command) ([]*model.Metric, error) {
+	if len(cmd.GetRegisters()) > 1 {
+		return e.readBlock(cmd)
+	}
 	raw, val, err := e.modbusClient.Read(cmd.GetRegister())
 	if err != nil {
 		e.logger.Warning("read error: %v", err)
-	} else {
-		e.logger.Trace("%v : %v : %s", raw, val, model.MetricKey(cmd.GetRegister()))
-		e.cache.Set(e.cache.Key(cmd.GetChannel(), cmd.GetRegister()), &model.Metric{
-			Key:       model.MetricKey(cmd.GetRegister()),
-			Channel:   cmd.GetRegister().Device.Channel.Title,
-			Device:    cmd.GetRegister().Device.Title,
-			Alias:     cmd.GetRegister().Device.Alias,
-			Register:  cmd.GetRegister().Title,
-			RawValue:  raw,
-			Value:     val,
-			Timestamp: time.Now(),
-		})
+		return nil, err
+	}
+	return e.storeMetric(cmd.GetRegister(), raw, val), nil
+}
+func (e *executorImpl) readBlock(cmd Command) ([]*model.Metric, error) {
+	registers := cmd.GetRegisters()
+	address, quantity := blockSpan(registers)
+	block := fmt.Sprintf("%s:%s:%s [%d+%d]", cmd.GetChannel().Title, cmd.GetDevice().Title, registers[0].Type, address, quantity)
+	if e.split[block] {
+		return e.readEach(registers)
+	}
+	results, err := e.modbusClient.ReadMultiple(registers)
+	if _, ok := ExceptionCode(err); ok {
+		// the block may span addresses the device does not have, though each of its registers exists
+		e.logger.Warning("read error: %s: %v, its registers are read one by one from now on", block, err)
+		e.split[block] = true
+		return e.readEach(registers)
+	}
+	if err != nil {
+		e.logger.Warning("read error: %s: %v", block, err)
+		return nil, err
+	}
+	var metrics []*model.Metric
+	for i, r := range registers {
+		if results[i].Err != nil {
+			e.logger.Warning("read error: %s: %v", model.MetricKey(r), results[i].Err)
+			err = results[i].Err
+			continue
+		}
+		metrics = append(metrics, e.storeMetric(r, results[i].Raw, results[i].Value)...)
+	}
+	return metrics, err
+}
+
+// readEach reads the registers one after another, a register's exception does not stop reading
+// the rest; the device not answering does, so that the command is retried
+func (e *executorImpl) readEach(registers []*model.Register) (metrics []*model.Metric, err error) {
+	for _, r := range registers {
+		raw, val, rErr := e.modbusClient.Read(r)
+		if rErr != nil {
+			e.logger.Warning("read error: %s: %v", model.MetricKey(r), rErr)
+			if IsUnreachable(rErr) {
+				return metrics, rErr
+			}
+			err = rErr
+			continue
+		}
+		metrics = append(metrics, e.storeMetric(r, raw, val)...)
 	}
+	return metrics, err
 }
-func (e *executorImpl) writeRegister(cmd Command) {
-	err := e.modbusClient.Write(cmd.GetRegister(), uint16(cmd.GetValue()))
+
+// storeMetric caches register's value along with its bit fields & returns the stored metrics
+func (e *executorImpl) storeMetric(register *model.Register, raw any, val float64) []*model.Metric {
+	e.logger.Trace("%v : %v : %s", raw, val, model.MetricKey(register))
+	metric := newMetric(register, model.MetricKey(register), raw, val)
+	if text, ok := raw.(string); ok {
+		metric.Text = text
+	}
+	e.cache.Set(e.cache.Key(register.Device.Channel, register), metric)
+	return append([]*model.Metric{metric}, e.storeBitFields(register, raw)...)
+}
+func (e *executorImpl) writeRegister(cmd Command) error {
+	if cmd.GetBitField() != nil {
+		return e.writeBitField(cmd)
+	}
+	if block, ok := cmd.GetValue().([]any); ok {
+		return e.modbusClient.WriteMultiple(cmd.GetRegister(), block)
+	}
+	return e.modbusClient.Write(cmd.GetRegister(), cmd.GetValue())
+}
+
+// writeBitField does read-modify-write of a register; as the executor is the only
+// one talking to the channel, no other command can get in between read and write
+func (e *executorImpl) writeBitField(cmd Command) error {
+	register := cmd.GetRegister()
+	raw, _, err := e.modbusClient.Read(register)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", model.MetricKey(register), err)
+	}
+	current, err := toUint64(raw)
+	if err != nil {
+		return err
+	}
+	bits, err := cmd.GetBitField().Insert(current, cmd.GetValue().(uint64))
 	if err != nil {
-		e.logger.Warning("write error: %v", err)
+		return err
+	}
+	value, err := fromUint64(register, bits)
+	if err != nil {
+		return err
+	}
+	return e.modbusClient.Write(register, value)
+}
+func (e *executorImpl) storeBitFields(register *model.Register, raw any) []*model.Metric {
+	if len(register.Bits) == 0 {
+		return nil
+	}
+	value, err := toUint64(raw)
+	if err != nil {
+		e.logger.Warning("bit field error: %v", err)
+		return nil
+	}
+	var metrics []*model.Metric
+	for i := range register.Bits {
+		field := &register.Bits[i]
+		bits := field.Extract(value)
+		metric := newMetric(register, model.BitMetricKey(register, field), bits, float64(bits))
+		metric.Register = fmt.Sprintf("%s.%s", register.Title, field.Title)
+		e.cache.Set(metric.Key, metric)
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+func newMetric(register *model.Register, key string, raw any, value float64) *model.Metric {
+	return &model.Metric{
+		Key:       key,
+		Channel:   register.Device.Channel.Title,
+		Device:    register.Device.Title,
+		Alias:     register.Device.Alias,
+		Register:  register.Title,
+		RawValue:  raw,
+		Value:     value,
+		Timestamp: time.Now(),
 	}
 }
@@ -0,0 +1,161 @@
+package bridge
+
+import (
+	"errors"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"os"
+	"testing"
+	"time"
+)
+
+// failingClient answers reads with the given errors in turn, succeeding once they are used up
+type failingClient struct {
+	ModbusClient
+	errs    []error
+	reads   int
+	blocks  int
+	writes  int
+	sends   int
+	timeout time.Duration
+}
+
+func (c *failingClient) Read(register *model.Register) (any, float64, error) {
+	c.reads++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, 0, err
+	}
+	return uint16(1), 1, nil
+}
+func (c *failingClient) ReadMultiple(registers []*model.Register) ([]ReadResult, error) {
+	c.blocks++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, err
+	}
+	results := make([]ReadResult, len(registers))
+	for i := range results {
+		results[i] = ReadResult{Raw: uint16(1), Value: 1}
+	}
+	return results, nil
+}
+func (c *failingClient) Write(register *model.Register, value any) error {
+	c.writes++
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return err
+	}
+	return nil
+}
+func (c *failingClient) Send(slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	c.sends++
+	return nil, os.ErrDeadlineExceeded
+}
+func (c *failingClient) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+func TestExecutorRetries(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "retries": 2, "retry_delay": "1ms", "devices": [
+		{"title": "d", "slave_id": 1, "timeout": "3s", "registers": [{"title": "r", "type": "holding"}]}]}]}`)
+	register := &config.Channels[0].Devices[0].Registers[0]
+	client := &failingClient{errs: []error{os.ErrDeadlineExceeded, os.ErrDeadlineExceeded}}
+	executor := CreateExecutor(nil, client, CreateMetricCache(time.Minute), CreateDeviceMonitor(&config.Channels[0])).(*executorImpl)
+
+	cmd := NewReadCommand(register.Device.Channel, register.Device, register)
+	executor.handleCommand(cmd)
+	if result := <-cmd.Done(); result.Err != nil || 3 != client.reads {
+		t.Errorf("expected success on 3rd attempt, got '%v' after %d reads", result.Err, client.reads)
+	}
+	if 3*time.Second != client.timeout {
+		t.Errorf("expected device timeout '3s' to be applied, got '%v' instead", client.timeout)
+	}
+
+	// exceptions are answers, they are not retried
+	exception := &modbus.ModbusError{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+	client.errs, client.reads = []error{exception}, 0
+	cmd = NewReadCommand(register.Device.Channel, register.Device, register)
+	executor.handleCommand(cmd)
+	if result := <-cmd.Done(); !errors.Is(result.Err, exception) || 1 != client.reads {
+		t.Errorf("expected exception without retry, got '%v' after %d reads", result.Err, client.reads)
+	}
+}
+func TestExecutorSkipsCancelled(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "devices": [{"title": "d", "slave_id": 1, "registers": [{"title": "r", "type": "holding"}]}]}]}`)
+	register := &config.Channels[0].Devices[0].Registers[0]
+	client := &failingClient{}
+	executor := CreateExecutor(nil, client, CreateMetricCache(time.Minute), CreateDeviceMonitor(&config.Channels[0])).(*executorImpl)
+
+	cmd := NewReadCommand(register.Device.Channel, register.Device, register)
+	if !cmd.Cancel() {
+		t.Fatal("expected pending command to be cancelled")
+	}
+	executor.handleCommand(cmd)
+	if 0 != client.reads {
+		t.Errorf("expected cancelled command not to be executed, got %d reads", client.reads)
+	}
+}
+
+// TestExecutorSplitsBlock has the device answer a block read with an exception, its registers are read
+// one by one from then on
+func TestExecutorSplitsBlock(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "devices": [{"title": "d", "slave_id": 1, "registers": [
+		{"title": "r1", "type": "holding", "address": 0}, {"title": "r2", "type": "holding", "address": 2}]}]}]}`)
+	device := &config.Channels[0].Devices[0]
+	registers := []*model.Register{&device.Registers[0], &device.Registers[1]}
+	exception := &modbus.ModbusError{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress}
+	client := &failingClient{errs: []error{exception}}
+	executor := CreateExecutor(nil, client, CreateMetricCache(time.Minute), CreateDeviceMonitor(&config.Channels[0])).(*executorImpl)
+
+	for range 2 {
+		cmd := NewBlockReadCommand(device.Channel, device, registers)
+		executor.handleCommand(cmd)
+		if result := <-cmd.Done(); result.Err != nil || 2 != len(result.Metrics) {
+			t.Errorf("expected both registers to be read, got %d metrics & '%v'", len(result.Metrics), result.Err)
+		}
+	}
+	if 1 != client.blocks || 4 != client.reads {
+		t.Errorf("expected a single block read followed by single reads, got %d block & %d single reads", client.blocks, client.reads)
+	}
+}
+
+// TestExecutorRetriesBeyondWriteTimeout has device's retries take longer than channel's write timeout,
+// the write is reported as done rather than timed out
+func TestExecutorRetriesBeyondWriteTimeout(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "write_timeout": "50ms", "retries": 2, "retry_delay": "40ms", "devices": [
+		{"title": "d", "slave_id": 1, "registers": [{"title": "r", "type": "holding", "mode": "rw"}]}]}]}`)
+	client := &failingClient{errs: []error{os.ErrDeadlineExceeded, os.ErrDeadlineExceeded}}
+	executor := CreateExecutor(nil, client, CreateMetricCache(time.Minute), CreateDeviceMonitor(&config.Channels[0])).(*executorImpl)
+	writeCmdChn := make(chan Command)
+	commander := CreateCommander(writeCmdChn, make(chan Command), &config.Channels[0], config)
+	go func() {
+		executor.handleCommand(<-writeCmdChn)
+	}()
+
+	start := time.Now()
+	if err := commander.WriteRef("c:d:r", 1); err != nil || 3 != client.writes {
+		t.Errorf("expected success on 3rd attempt, got '%v' after %d writes", err, client.writes)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected retries to take longer than the write timeout, took %v", elapsed)
+	}
+}
+
+func TestExecutorDoesNotRetryPassthrough(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "retries": 2, "retry_delay": "1ms", "devices": [{"title": "d", "slave_id": 1}]}]}`)
+	device := &config.Channels[0].Devices[0]
+	client := &failingClient{}
+	executor := CreateExecutor(nil, client, CreateMetricCache(time.Minute), CreateDeviceMonitor(&config.Channels[0])).(*executorImpl)
+
+	// a write passed through may have been executed even if its answer was lost
+	cmd := NewRawCommand(device.Channel, device, &modbus.ProtocolDataUnit{FunctionCode: 6, Data: []byte{0, 1, 0, 2}})
+	executor.handleCommand(cmd)
+	if result := <-cmd.Done(); !IsUnreachable(result.Err) || 1 != client.sends {
+		t.Errorf("expected a single attempt, got '%v' after %d sends", result.Err, client.sends)
+	}
+}
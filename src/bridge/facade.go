@@ -0,0 +1,206 @@
+package bridge
+
+import (
+	"errors"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"mbridge/server"
+	"mbridge/util"
+	"slices"
+)
+
+// facadeRegister is a register of the bridge exposed at a virtual address of a server unit
+type facadeRegister struct {
+	register  *model.Register
+	reference string
+	address   uint16
+}
+
+func (r *facadeRegister) end() int {
+	return int(r.address) + int(r.register.Size)
+}
+
+// facadeImpl is the data store of the Modbus TCP server: reads are served with raw register values
+// from the metric cache, writes are sent to the devices through the channels' commanders
+type facadeImpl struct {
+	bridge Bridge
+	units  map[uint8]map[model.RegType][]*facadeRegister
+}
+
+func CreateFacade(config *model.Config, bridge Bridge) (server.DataStore, error) {
+	f := &facadeImpl{
+		bridge: bridge,
+		units:  make(map[uint8]map[model.RegType][]*facadeRegister),
+	}
+	for _, u := range config.ModbusServer.Units {
+		tables, ok := f.units[u.UnitId]
+		if !ok {
+			tables = make(map[model.RegType][]*facadeRegister)
+			f.units[u.UnitId] = tables
+		}
+		for _, r := range u.Registers {
+			register, err := config.FindRegister(r.Reference)
+			if err != nil {
+				return nil, err
+			}
+			tables[register.Type] = append(tables[register.Type], &facadeRegister{register, model.MetricKey(register), r.Address})
+		}
+		for _, table := range tables {
+			slices.SortFunc(table, func(a, b *facadeRegister) int { return int(a.address) - int(b.address) })
+		}
+	}
+	return f, nil
+}
+
+func (f *facadeImpl) ReadBits(unitId uint8, table model.RegType, address, quantity uint16) ([]bool, error) {
+	registers, err := f.lookup(unitId, table, address, quantity, false)
+	if err != nil {
+		return nil, err
+	}
+	bits := make([]bool, quantity)
+	for _, r := range registers {
+		metric, err := f.get(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := toUint64(metric.RawValue)
+		if err != nil {
+			return nil, exception(modbus.ExceptionCodeServerDeviceFailure)
+		}
+		for i := max(int(address), int(r.address)); i < min(int(address)+int(quantity), r.end()); i++ {
+			bits[i-int(address)] = value&(1<<(i-int(r.address))) != 0
+		}
+	}
+	return bits, nil
+}
+func (f *facadeImpl) ReadWords(unitId uint8, table model.RegType, address, quantity uint16) ([]byte, error) {
+	registers, err := f.lookup(unitId, table, address, quantity, false)
+	if err != nil {
+		return nil, err
+	}
+	words := make([]byte, 2*int(quantity))
+	for _, r := range registers {
+		metric, err := f.get(r)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encode(r.register, metric.RawValue)
+		if err != nil || len(data) != 2*int(r.register.Size) {
+			return nil, exception(modbus.ExceptionCodeServerDeviceFailure)
+		}
+		for i := max(int(address), int(r.address)); i < min(int(address)+int(quantity), r.end()); i++ {
+			copy(words[2*(i-int(address)):], data[2*(i-int(r.address)):2*(i-int(r.address)+1)])
+		}
+	}
+	return words, nil
+}
+
+// WriteBits writes coils; registers can only be written as a whole
+func (f *facadeImpl) WriteBits(unitId uint8, address uint16, values []bool) error {
+	registers, err := f.lookup(unitId, model.COIL, address, uint16(len(values)), true)
+	if err != nil {
+		return err
+	}
+	for _, r := range registers {
+		offset := int(r.address) - int(address)
+		raw := make([]float64, r.register.Size)
+		for i := range raw {
+			if values[offset+i] {
+				raw[i] = 1
+			}
+		}
+		if len(raw) == 1 {
+			err = f.bridge.SetRaw(r.reference, raw[0])
+		} else {
+			err = f.bridge.SetRawMultiple(r.reference, raw)
+		}
+		if err != nil {
+			return writeException(err)
+		}
+	}
+	return nil
+}
+
+// WriteWords writes holding registers; registers can only be written as a whole
+func (f *facadeImpl) WriteWords(unitId uint8, address uint16, data []byte) error {
+	registers, err := f.lookup(unitId, model.HOLDING, address, uint16(len(data)/2), true)
+	if err != nil {
+		return err
+	}
+	for _, r := range registers {
+		offset := 2 * (int(r.address) - int(address))
+		value, err := decode(r.register, data[offset:offset+2*int(r.register.Size)])
+		if err != nil {
+			return exception(modbus.ExceptionCodeIllegalDataValue)
+		}
+		if text, ok := value.(string); ok {
+			err = f.bridge.SetText(r.reference, text)
+		} else {
+			raw, e := util.ToFloat64(value)
+			if e != nil {
+				return exception(modbus.ExceptionCodeIllegalDataValue)
+			}
+			err = f.bridge.SetRaw(r.reference, raw)
+		}
+		if err != nil {
+			return writeException(err)
+		}
+	}
+	return nil
+}
+
+// lookup returns registers overlapping the address range, which has to be mapped completely;
+// for writes the registers also have to be writable & lie completely within the range
+func (f *facadeImpl) lookup(unitId uint8, table model.RegType, address, quantity uint16, write bool) ([]*facadeRegister, error) {
+	tables, ok := f.units[unitId]
+	if !ok {
+		return nil, exception(modbus.ExceptionCodeGatewayPathUnavailable)
+	}
+	start, end := int(address), int(address)+int(quantity)
+	var result []*facadeRegister
+	covered := 0
+	for _, r := range tables[table] {
+		if r.end() <= start || int(r.address) >= end {
+			continue
+		}
+		if write && (int(r.address) < start || r.end() > end || r.register.Mode == model.RO) {
+			return nil, exception(modbus.ExceptionCodeIllegalDataAddress)
+		}
+		covered += min(end, r.end()) - max(start, int(r.address))
+		result = append(result, r)
+	}
+	if covered != int(quantity) {
+		return nil, exception(modbus.ExceptionCodeIllegalDataAddress)
+	}
+	return result, nil
+}
+
+// get returns register's cached value; a register without (fresh) value is reported as not answering device
+func (f *facadeImpl) get(r *facadeRegister) (*model.Metric, error) {
+	metric, err := f.bridge.Get(r.reference)
+	if err != nil || metric == nil {
+		return nil, exception(modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond)
+	}
+	return metric, nil
+}
+
+func exception(code byte) error {
+	return &modbus.ModbusError{ExceptionCode: code}
+}
+
+// writeException maps write errors to exceptions, passing through device's own exceptions
+func writeException(err error) error {
+	if code, ok := ExceptionCode(err); ok {
+		return exception(code)
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return exception(modbus.ExceptionCodeIllegalDataAddress)
+	case errors.Is(err, ErrQueueFull):
+		return exception(modbus.ExceptionCodeServerDeviceBusy)
+	case errors.Is(err, ErrTimeout) || errors.Is(err, ErrDevice) || errors.Is(err, ErrStopped):
+		return exception(modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond)
+	default:
+		return exception(modbus.ExceptionCodeIllegalDataValue)
+	}
+}
@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	"errors"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"mbridge/server"
+	"testing"
+	"time"
+)
+
+// cacheBridge serves metrics from a map & records raw writes
+type cacheBridge struct {
+	Bridge
+	metrics map[string]*model.Metric
+	writes  map[string][]float64
+}
+
+func (b *cacheBridge) Get(reference string) (*model.Metric, error) {
+	return b.metrics[reference], nil
+}
+func (b *cacheBridge) SetRaw(reference string, value float64) error {
+	b.writes[reference] = []float64{value}
+	return nil
+}
+func (b *cacheBridge) SetRawMultiple(reference string, values []float64) error {
+	b.writes[reference] = values
+	return nil
+}
+
+func TestFacade(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "devices": [{"title": "d", "slave_id": 1, "registers": [
+		{"title": "temp", "type": "input", "data_type": "float32"},
+		{"title": "setpoint", "type": "holding", "mode": "rw"},
+		{"title": "mode", "type": "holding", "mode": "rw", "data_type": "uint32"},
+		{"title": "pump", "type": "coil", "mode": "rw"}]}]}],
+		"modbus_server": {"units": [{"unit_id": 7, "registers": [
+		{"reference": "c:d:temp", "address": 100},
+		{"reference": "c:d:setpoint", "address": 10},
+		{"reference": "c:d:mode", "address": 11},
+		{"reference": "c:d:pump", "address": 0}]}]}}`)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	br := &cacheBridge{
+		metrics: map[string]*model.Metric{
+			"c:d:temp":     {RawValue: float32(21.5)},
+			"c:d:setpoint": {RawValue: uint16(225)},
+			"c:d:pump":     {RawValue: uint16(1)},
+		},
+		writes: make(map[string][]float64),
+	}
+	facade, err := CreateFacade(config, br)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	srv := server.CreateServer("127.0.0.1:0", server.NewDataHandler(facade))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer srv.Stop()
+	handler := modbus.NewTCPClientHandler(srv.Addr().String())
+	handler.Timeout = time.Second
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	if results, err := client.ReadInputRegisters(7, 100, 2); err != nil || "\x41\xac\x00\x00" != string(results) {
+		t.Errorf("expected float32 21.5 words, got '% x' (%v)", results, err)
+	}
+	if results, err := client.ReadCoils(7, 0, 1); err != nil || "\x01" != string(results) {
+		t.Errorf("expected coil on, got '% x' (%v)", results, err)
+	}
+	// register without cached value is reported as not answering, unmapped address as illegal
+	if _, err := client.ReadHoldingRegisters(7, 10, 3); !isException(err, modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond) {
+		t.Errorf("expected gateway target exception, got '%v'", err)
+	}
+	if _, err := client.ReadHoldingRegisters(7, 9, 2); !isException(err, modbus.ExceptionCodeIllegalDataAddress) {
+		t.Errorf("expected illegal address exception, got '%v'", err)
+	}
+
+	if _, err := client.WriteMultipleRegisters(7, 10, 3, []byte{0, 230, 0, 1, 0, 2}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if v := br.writes["c:d:setpoint"]; len(v) != 1 || 230 != v[0] {
+		t.Errorf("expected setpoint write of 230, got %v", v)
+	}
+	if v := br.writes["c:d:mode"]; len(v) != 1 || 0x10002 != v[0] {
+		t.Errorf("expected mode write of 0x10002, got %v", v)
+	}
+	// a part of a multi-word register can not be written
+	if _, err := client.WriteSingleRegister(7, 12, 1); !isException(err, modbus.ExceptionCodeIllegalDataAddress) {
+		t.Errorf("expected illegal address exception, got '%v'", err)
+	}
+	if _, err := client.WriteSingleCoil(7, 0, 0xFF00); err != nil || 1 != br.writes["c:d:pump"][0] {
+		t.Errorf("expected pump write, got %v (%v)", br.writes["c:d:pump"], err)
+	}
+
+	if _, err := client.ReadCoils(8, 0, 1); !isException(err, modbus.ExceptionCodeGatewayPathUnavailable) {
+		t.Errorf("expected gateway path exception for unknown unit, got '%v'", err)
+	}
+}
+
+func isException(err error, code byte) bool {
+	var modbusError *modbus.ModbusError
+	return errors.As(err, &modbusError) && code == modbusError.ExceptionCode
+}
@@ -0,0 +1,144 @@
+package bridge
+
+import (
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"mbridge/util"
+	"sync"
+	"time"
+)
+
+// failoverHandler passes requests to the handler of channel's active connection; after the
+// failover threshold of consecutive connection failures the handler is rebuilt against the next
+// connection; once the failback interval passes the primary connection is probed & used again if it answers
+type failoverHandler struct {
+	channel   *model.Channel
+	factory   func(channel *model.Channel, endpoint string) modbus.ClientHandler
+	endpoints []string
+	threshold int
+	failback  time.Duration
+	logger    util.Logger
+
+	mutex    sync.Mutex
+	handler  modbus.ClientHandler
+	active   int
+	failures int
+	switched time.Time
+}
+
+func newFailoverHandler(factory func(channel *model.Channel, endpoint string) modbus.ClientHandler, channel *model.Channel) *failoverHandler {
+	h := &failoverHandler{
+		channel:   channel,
+		factory:   factory,
+		endpoints: channel.GetEndpoints(),
+		threshold: channel.GetFailoverThreshold(),
+		failback:  channel.GetFailbackInterval(),
+		logger:    util.GetLogger("failover"),
+	}
+	h.handler = factory(channel, h.endpoints[0])
+	return h
+}
+
+func (h *failoverHandler) Encode(slaveId uint8, pdu *modbus.ProtocolDataUnit) (adu []byte, err error) {
+	return h.current().Encode(slaveId, pdu)
+}
+func (h *failoverHandler) Decode(adu []byte) (pdu *modbus.ProtocolDataUnit, err error) {
+	return h.current().Decode(adu)
+}
+func (h *failoverHandler) Verify(aduRequest []byte, aduResponse []byte) (err error) {
+	return h.current().Verify(aduRequest, aduResponse)
+}
+
+// Send sends the request over the active connection; switching connections happens after
+// the request, so that the request is encoded, sent and verified by the same handler
+func (h *failoverHandler) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	aduResponse, err = h.current().Send(aduRequest)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err == nil {
+		h.failures = 0
+		if h.active != 0 && time.Since(h.switched) >= h.failback {
+			h.failBack(aduRequest)
+		}
+		return
+	}
+	// a slave not answering behind a working gateway is reported by the device monitor instead
+	if !IsConnectionFailure(err) {
+		return
+	}
+	h.failures++
+	if len(h.endpoints) > 1 && h.failures >= h.threshold {
+		next := (h.active + 1) % len(h.endpoints)
+		h.logger.Warning("channel %s: %d errors on %s, switching to %s: %v",
+			h.channel.Title, h.failures, h.endpoints[h.active], h.endpoints[next], err)
+		h.use(next)
+	}
+	return
+}
+
+// failBack switches to the primary connection if it passes a probe, otherwise the primary is probed
+// again after another failback interval; caller must hold the mutex
+func (h *failoverHandler) failBack(aduRequest []byte) {
+	primary := h.factory(h.channel, h.endpoints[0])
+	setHandlerTimeout(primary, handlerTimeout(h.handler))
+	err := probe(primary, aduRequest)
+	if closer, ok := primary.(interface{ Close() error }); ok {
+		_ = closer.Close()
+	}
+	if err != nil {
+		h.logger.Debug("channel %s: %s is still unavailable: %v", h.channel.Title, h.endpoints[0], err)
+		h.switched = time.Now()
+		return
+	}
+	h.logger.Info("channel %s: failing back to %s", h.channel.Title, h.endpoints[0])
+	h.use(0)
+}
+
+// probe connects the handler & repeats the request over it if it is a read, which leaves device's
+// state as it is; other requests are not repeated, so that a write is not executed twice
+func probe(handler modbus.ClientHandler, aduRequest []byte) error {
+	if connector, ok := handler.(interface{ Connect() error }); ok {
+		if err := connector.Connect(); err != nil {
+			return err
+		}
+	}
+	pdu, err := handler.Decode(aduRequest)
+	if err != nil || pdu.FunctionCode < modbus.FuncCodeReadCoils || pdu.FunctionCode > modbus.FuncCodeReadInputRegisters {
+		return nil
+	}
+	aduResponse, err := handler.Send(aduRequest)
+	if err != nil {
+		return err
+	}
+	return handler.Verify(aduRequest, aduResponse)
+}
+
+// Endpoint returns the connection requests are currently sent over
+func (h *failoverHandler) Endpoint() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.endpoints[h.active]
+}
+func (h *failoverHandler) Endpoints() []string {
+	return h.endpoints
+}
+
+func (h *failoverHandler) current() modbus.ClientHandler {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.handler
+}
+
+// use closes the handler of the active connection & builds one for the given connection,
+// keeping the response timeout last set by the executor; caller must hold the mutex
+func (h *failoverHandler) use(index int) {
+	if closer, ok := h.handler.(interface{ Close() error }); ok {
+		_ = closer.Close()
+	}
+	timeout := handlerTimeout(h.handler)
+	h.handler = h.factory(h.channel, h.endpoints[index])
+	setHandlerTimeout(h.handler, timeout)
+	h.active = index
+	h.failures = 0
+	h.switched = time.Now()
+}
@@ -0,0 +1,109 @@
+package bridge
+
+import (
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubHandler answers requests unless its endpoint is listed as down or the slave as silent
+type stubHandler struct {
+	modbus.Packager
+	endpoint string
+	down     map[string]bool
+	silent   map[byte]bool
+}
+
+func (h *stubHandler) Connect() error {
+	if h.down[h.endpoint] {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	}
+	return nil
+}
+func (h *stubHandler) Send(aduRequest []byte) ([]byte, error) {
+	if err := h.Connect(); err != nil {
+		return nil, err
+	}
+	// unit id follows the MBAP header
+	if h.silent[aduRequest[6]] {
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	}
+	return aduRequest, nil
+}
+
+func TestFailoverHandler(t *testing.T) {
+	channel := &model.Channel{Title: "c", Mode: model.TCP, Connections: []string{"primary", "secondary"}}
+	threshold, failback := 2, "50ms"
+	channel.Failover = &model.Failover{Threshold: &threshold, Failback: &failback}
+	down := map[string]bool{"primary": true}
+	var built []string
+	handler := newFailoverHandler(func(channel *model.Channel, endpoint string) modbus.ClientHandler {
+		built = append(built, endpoint)
+		return &stubHandler{Packager: modbus.NewTCPClientHandler(endpoint), endpoint: endpoint, down: down}
+	}, channel)
+	read, _ := modbus.NewTCPClientHandler("").Encode(1, &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}})
+
+	for range threshold {
+		if _, err := handler.Send(read); err == nil {
+			t.Fatal("expected primary to fail")
+		}
+	}
+	if "secondary" != handler.Endpoint() {
+		t.Fatalf("expected failover to secondary, got '%s' instead", handler.Endpoint())
+	}
+	if _, err := handler.Send(read); err != nil {
+		t.Fatalf("expected secondary to answer, got '%v' instead", err)
+	}
+
+	// primary is probed after failback interval, it is not used while it does not answer
+	time.Sleep(60 * time.Millisecond)
+	for range threshold {
+		if _, err := handler.Send(read); err != nil {
+			t.Fatalf("expected secondary to answer, got '%v' instead", err)
+		}
+	}
+	if "secondary" != handler.Endpoint() {
+		t.Fatalf("expected secondary to be kept, got '%s' instead", handler.Endpoint())
+	}
+	if 0 != handler.failures {
+		t.Errorf("expected no failures on secondary, got %d instead", handler.failures)
+	}
+
+	// primary is used once it answers the probe
+	down["primary"] = false
+	time.Sleep(60 * time.Millisecond)
+	handler.Send(read)
+	if "primary" != handler.Endpoint() {
+		t.Errorf("expected failback to primary, got '%s' instead", handler.Endpoint())
+	}
+	if expected := "primary secondary primary primary primary"; expected != strings.Join(built, " ") {
+		t.Errorf("expected handlers for '%s', got '%s' instead", expected, strings.Join(built, " "))
+	}
+}
+
+// TestFailoverSilentSlave has a slave not answering behind an answering connection, the connection is kept
+func TestFailoverSilentSlave(t *testing.T) {
+	channel := &model.Channel{Title: "c", Mode: model.TCP, Connections: []string{"primary", "secondary"}}
+	threshold := 2
+	channel.Failover = &model.Failover{Threshold: &threshold}
+	handler := newFailoverHandler(func(channel *model.Channel, endpoint string) modbus.ClientHandler {
+		return &stubHandler{Packager: modbus.NewTCPClientHandler(endpoint), endpoint: endpoint, silent: map[byte]bool{2: true}}
+	}, channel)
+	read, _ := modbus.NewTCPClientHandler("").Encode(2, &modbus.ProtocolDataUnit{
+		FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 0, 0, 1}})
+
+	for range 3 * threshold {
+		if _, err := handler.Send(read); !IsDeviceTimeout(err) {
+			t.Fatalf("expected slave to time out, got '%v' instead", err)
+		}
+	}
+	if "primary" != handler.Endpoint() {
+		t.Errorf("expected connection to be kept, got '%s' instead", handler.Endpoint())
+	}
+}
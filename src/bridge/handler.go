@@ -0,0 +1,153 @@
+package bridge
+
+import (
+	"github.com/goburrow/serial"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"mbridge/util"
+	"time"
+)
+
+// default timeouts of encapsulated RTU channels, which are shorter than the library's ones
+const (
+	encTimeout     = 1 * time.Second
+	encIdleTimeout = 2 * time.Second
+)
+
+func createModbusClient(handlerFactory func(channel *model.Channel, endpoint string) modbus.ClientHandler,
+	channel *model.Channel, config *model.Config) (ModbusClient, *failoverHandler) {
+	handler := newFailoverHandler(handlerFactory, channel)
+	client := modbus.NewClient(handler)
+	return NewModbusClient(config, &client, handler), handler
+}
+func createModbusHandlerFactory(channel *model.Channel, endpoint string) modbus.ClientHandler {
+	timeout, idleTimeout := channel.GetTimeout(), channel.GetIdleTimeout()
+	switch channel.Mode {
+	case model.ENC:
+		_handler := modbus.NewEncClientHandler(endpoint)
+		_handler.Timeout = positiveOrDefault(timeout, encTimeout)
+		_handler.IdleTimeout = positiveOrDefault(idleTimeout, encIdleTimeout)
+		//_handler.Logger = log.New(os.Stdout, fmt.Sprintf("[%s]: ", connection), log.LstdFlags|log.Lmicroseconds)
+		return _handler
+	case model.TCP:
+		_handler := modbus.NewTCPClientHandler(endpoint)
+		_handler.Timeout = positiveOrDefault(timeout, _handler.Timeout)
+		_handler.IdleTimeout = positiveOrDefault(idleTimeout, _handler.IdleTimeout)
+		//_handler.Logger = log.New(os.Stdout, fmt.Sprintf("[%s]: ", connection), log.LstdFlags|log.Lmicroseconds)
+		return _handler
+	case model.RTU:
+		_handler := modbus.NewRTUClientHandler(endpoint)
+		_handler.Timeout = positiveOrDefault(timeout, _handler.Timeout)
+		_handler.IdleTimeout = positiveOrDefault(idleTimeout, _handler.IdleTimeout)
+		applySerial(&_handler.Config, channel.GetSerial())
+		//_handler.Logger = log.New(os.Stdout, fmt.Sprintf("[%s]: ", connection), log.LstdFlags|log.Lmicroseconds)
+		return _handler
+	case model.ASCII:
+		_handler := modbus.NewASCIIClientHandler(endpoint)
+		_handler.Timeout = positiveOrDefault(timeout, _handler.Timeout)
+		_handler.IdleTimeout = positiveOrDefault(idleTimeout, _handler.IdleTimeout)
+		applySerial(&_handler.Config, channel.GetSerial())
+		return _handler
+	case model.UDP:
+		_handler := NewUDPClientHandler(endpoint)
+		_handler.Timeout = positiveOrDefault(timeout, _handler.Timeout)
+		_handler.IdleTimeout = positiveOrDefault(idleTimeout, _handler.IdleTimeout)
+		return _handler
+	case model.TLS:
+		var settings model.TLSSettings
+		if nil != channel.TLS {
+			settings = *channel.TLS
+		}
+		config, err := settings.Load()
+		_handler := NewTLSClientHandler(endpoint, config, err)
+		if err = _handler.Err(); err != nil {
+			util.GetLogger("modbus").Error("channel %s: %v", channel.Title, err)
+		} else if _handler.Role == "" {
+			util.GetLogger("modbus").Warning("channel %s: client certificate carries no role", channel.Title)
+		} else {
+			util.GetLogger("modbus").Info("channel %s: connecting with role '%s'", channel.Title, _handler.Role)
+		}
+		_handler.Timeout = positiveOrDefault(timeout, _handler.Timeout)
+		_handler.IdleTimeout = positiveOrDefault(idleTimeout, _handler.IdleTimeout)
+		return _handler
+	case model.SIM:
+		// the connection is not used, a simulated channel never fails over
+		return NewSimClientHandler(NewSimulator(channel))
+	}
+	return nil
+}
+
+// applySerial sets serial port's line parameters and RS-485 options
+func applySerial(config *serial.Config, settings model.Serial) {
+	config.BaudRate = settings.GetBaud()
+	config.DataBits = settings.GetDataBits()
+	config.Parity = settings.GetParity()
+	config.StopBits = settings.GetStopBits()
+	if nil != settings.RS485 {
+		config.RS485 = serial.RS485Config{
+			Enabled:            settings.RS485.Enabled,
+			DelayRtsBeforeSend: settings.RS485.GetDelayRtsBeforeSend(),
+			DelayRtsAfterSend:  settings.RS485.GetDelayRtsAfterSend(),
+			RtsHighDuringSend:  settings.RS485.RtsHighDuringSend,
+			RtsHighAfterSend:   settings.RS485.RtsHighAfterSend,
+			RxDuringTx:         settings.RS485.RxDuringTx,
+		}
+	}
+}
+
+// handlerTimeout returns the response timeout the handler is configured with
+func handlerTimeout(handler modbus.ClientHandler) time.Duration {
+	switch h := handler.(type) {
+	case *failoverHandler:
+		return handlerTimeout(h.current())
+	case *modbus.EncClientHandler:
+		return h.Timeout
+	case *modbus.TCPClientHandler:
+		return h.Timeout
+	case *modbus.RTUClientHandler:
+		return h.Timeout
+	case *modbus.ASCIIClientHandler:
+		return h.Timeout
+	case *UDPClientHandler:
+		return h.Timeout
+	case *TLSClientHandler:
+		return h.Timeout
+	}
+	return 0
+}
+
+// setHandlerTimeout changes the handler's response timeout; a serial port applies
+// its timeout when opened, so it is closed to be reopened by the next request; as the
+// timeout only changes between devices with different timeouts & the poller reads
+// devices' registers one after another, this is about once per device & cycle
+func setHandlerTimeout(handler modbus.ClientHandler, timeout time.Duration) {
+	switch h := handler.(type) {
+	case *failoverHandler:
+		setHandlerTimeout(h.current(), timeout)
+	case *modbus.EncClientHandler:
+		h.Timeout = timeout
+	case *modbus.TCPClientHandler:
+		h.Timeout = timeout
+	case *modbus.RTUClientHandler:
+		if h.Timeout != timeout {
+			h.Timeout = timeout
+			_ = h.Close()
+		}
+	case *modbus.ASCIIClientHandler:
+		if h.Timeout != timeout {
+			h.Timeout = timeout
+			_ = h.Close()
+		}
+	case *UDPClientHandler:
+		h.Timeout = timeout
+	case *TLSClientHandler:
+		h.Timeout = timeout
+	}
+}
+
+func positiveOrDefault(value, defaultValue time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,24 @@
+package bridge
+
+import (
+	"github.com/mvkvl/modbus"
+	"mbridge/model/modeltest"
+	"testing"
+	"time"
+)
+
+func TestSerialDeviceTimeout(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "mode": "rtu", "connection": "/dev/null", "timeout": "1s", "devices": [
+		{"title": "fast", "slave_id": 1},
+		{"title": "slow", "slave_id": 2, "timeout": "3s"}]}]}`)
+	handler := createModbusHandlerFactory(&config.Channels[0], "/dev/null").(*modbus.RTUClientHandler)
+	if time.Second != handler.Timeout {
+		t.Errorf("expected channel timeout '1s', got '%v' instead", handler.Timeout)
+	}
+	for _, device := range config.Channels[0].Devices {
+		setHandlerTimeout(handler, device.GetTimeout())
+		if device.GetTimeout() != handler.Timeout {
+			t.Errorf("%s: expected device timeout '%v', got '%v' instead", device.Title, device.GetTimeout(), handler.Timeout)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package bridge
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// idleConn is the connection of a handler: it is dialed on demand & closed once it has not
+// been used for the idle timeout; the handler holds the lock while it uses the connection
+type idleConn struct {
+	dial func() (net.Conn, error)
+
+	mu           sync.Mutex
+	conn         net.Conn
+	closeTimer   *time.Timer
+	lastActivity time.Time
+	idleTimeout  time.Duration
+}
+
+func (c *idleConn) connect() error {
+	if c.conn == nil {
+		conn, err := c.dial()
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+	return nil
+}
+
+// use marks the connection as active, restarting the idle timer, & sets the deadline of the request
+func (c *idleConn) use(timeout, idleTimeout time.Duration) error {
+	c.lastActivity = time.Now()
+	c.idleTimeout = idleTimeout
+	c.startCloseTimer()
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = c.lastActivity.Add(timeout)
+	}
+	return c.conn.SetDeadline(deadline)
+}
+func (c *idleConn) close() (err error) {
+	if c.conn != nil {
+		err = c.conn.Close()
+		c.conn = nil
+	}
+	return
+}
+func (c *idleConn) startCloseTimer() {
+	if c.idleTimeout <= 0 {
+		return
+	}
+	if c.closeTimer == nil {
+		c.closeTimer = time.AfterFunc(c.idleTimeout, c.closeIdle)
+	} else {
+		c.closeTimer.Reset(c.idleTimeout)
+	}
+}
+func (c *idleConn) closeIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.idleTimeout > 0 && time.Since(c.lastActivity) >= c.idleTimeout {
+		c.close()
+	}
+}
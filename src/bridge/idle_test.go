@@ -0,0 +1,35 @@
+package bridge
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIdleConn(t *testing.T) {
+	dials := 0
+	c := &idleConn{dial: func() (net.Conn, error) {
+		dials++
+		conn, _ := net.Pipe()
+		return conn, nil
+	}}
+	c.mu.Lock()
+	if err := c.connect(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := c.use(time.Second, 20*time.Millisecond); err != nil {
+		t.Fatalf("%s", err)
+	}
+	c.mu.Unlock()
+
+	// the connection is closed once idle & dialed again by the next request
+	time.Sleep(50 * time.Millisecond)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if nil != c.conn {
+		t.Fatal("expected idle connection to be closed")
+	}
+	if err := c.connect(); err != nil || 2 != dials {
+		t.Errorf("expected connection to be dialed again, got %d dials (%v)", dials, err)
+	}
+}
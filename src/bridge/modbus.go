@@ -4,33 +4,48 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"github.com/maja42/goval"
 	"github.com/mvkvl/modbus"
 	"math"
 	"mbridge/model"
 	"mbridge/util"
+	"time"
 )
 
 // region - API
 
 type Reader interface {
-	Read(register *model.Register) (raw uint32, value float64, err error)
-	ReadRef(reference string) (raw uint32, value float64, title string, err error)
+	Read(register *model.Register) (raw any, value float64, err error)
+	ReadMultiple(registers []*model.Register) (results []ReadResult, err error)
+	ReadRef(reference string) (raw any, value float64, title string, err error)
 }
 type Writer interface {
-	Write(register *model.Register, value uint16) (err error)
-	WriteRef(reference string, value uint16) (err error)
+	Write(register *model.Register, value any) (err error)
+	WriteMultiple(register *model.Register, values []any) (err error)
+	WriteRef(reference string, value any) (err error)
+}
+
+// ReadResult is the outcome of reading one of the registers of a block read
+type ReadResult struct {
+	Raw   any
+	Value float64
+	Err   error
 }
 type ModbusClient interface {
 	Reader
 	Writer
+	// Send sends the request PDU to the slave as is, returning its response, exception responses included
+	Send(slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error)
+	// SetTimeout changes the response timeout of following requests; zero restores the channel's one
+	SetTimeout(timeout time.Duration)
 }
 
-func NewModbusClient(config *model.Config, client *modbus.Client) ModbusClient {
+func NewModbusClient(config *model.Config, client *modbus.Client, handler modbus.ClientHandler) ModbusClient {
 	return &modbusClient{
-		config: config,
-		client: client,
-		logger: util.GetLogger("modbus"),
+		config:  config,
+		client:  client,
+		handler: handler,
+		timeout: handlerTimeout(handler),
+		logger:  util.GetLogger("modbus"),
 	}
 }
 
@@ -39,56 +54,89 @@ func NewModbusClient(config *model.Config, client *modbus.Client) ModbusClient {
 // region - client implementation
 
 type modbusClient struct {
-	config *model.Config
-	client *modbus.Client
-	logger util.Logger
+	config  *model.Config
+	client  *modbus.Client
+	handler modbus.ClientHandler
+	timeout time.Duration
+	logger  util.Logger
 }
 
 // region => public API
 // region ~> read
 
-// Read reads up to 2 words of bus data & converts it to uint32
+// Read reads register's bus data & decodes it according to register's data type and byte order
 
-func (c *modbusClient) Read(register *model.Register) (raw uint32, value float64, err error) {
+func (c *modbusClient) Read(register *model.Register) (raw any, value float64, err error) {
 	reader := c.getReaderFunction(register)
 	if reader == nil {
-		return 0, 0, fmt.Errorf("nil modbus reader")
+		return nil, 0, fmt.Errorf("nil modbus reader")
 	}
 	buff, err := reader(register.Device.SlaveId, register.Address, register.Size)
 	if nil != err {
-		return 0, 0, fmt.Errorf("", err)
-	}
-	var val uint32
-	if 0 == len(buff) {
-		return 0, 0, errors.New("no value")
-	} else if 1 == len(buff) {
-		val = uint32(buff[0])
-	} else if 2 == len(buff) {
-		val = uint32(binary.BigEndian.Uint16(buff))
-	} else if 4 == len(buff) {
-		//log.Warn("NxBuff: % 0x, a: % 0x, b: % 0x\n", buff, buff[:2], buff[2:])
-		val = uint32(binary.BigEndian.Uint16(buff[:2]))<<8 + uint32(binary.BigEndian.Uint16(buff[2:]))
-	} else {
-		return 0, math.NaN(), errors.New(fmt.Sprintf("read: too large data chunk received: % 0x", buff))
-	}
-	expression := fmt.Sprintf("%f * %d", register.Factor, val)
-	eval := goval.NewEvaluator()
-	v, err := eval.Evaluate(expression, nil, nil)
-	switch i := v.(type) {
-	case float64:
-		return val, i, nil
-	case float32:
-		return val, float64(i), nil
-	case int64:
-		return val, float64(i), nil
-	default:
-		return val, math.NaN(), errors.New("read: unknown value is of incompatible type")
+		return nil, 0, fmt.Errorf("read: %w", err)
 	}
+	return c.convert(register, buff)
 }
-func (c *modbusClient) ReadRef(reference string) (raw uint32, value float64, title string, err error) {
+
+// ReadMultiple reads registers of the same slave and type with a single request
+// & splits the received data back into per-register values
+
+func (c *modbusClient) ReadMultiple(registers []*model.Register) (results []ReadResult, err error) {
+	if 0 == len(registers) {
+		return nil, nil
+	}
+	first := registers[0]
+	reader := c.getReaderFunction(first)
+	if reader == nil {
+		return nil, fmt.Errorf("nil modbus reader")
+	}
+	address, quantity := blockSpan(registers)
+	buff, err := reader(first.Device.SlaveId, address, quantity)
+	if nil != err {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	results = make([]ReadResult, len(registers))
+	for i, r := range registers {
+		var data []byte
+		offset := int(r.Address - address)
+		if r.IsBit() {
+			data, err = sliceBits(buff, offset, int(r.Size))
+		} else {
+			data, err = sliceWords(buff, offset, int(r.Size))
+		}
+		if nil != err {
+			results[i] = ReadResult{Err: err}
+			continue
+		}
+		raw, value, err := c.convert(r, data)
+		results[i] = ReadResult{Raw: raw, Value: value, Err: err}
+	}
+	return results, nil
+}
+
+// convert decodes register's bus data & transforms it into engineering value
+func (c *modbusClient) convert(register *model.Register, buff []byte) (raw any, value float64, err error) {
+	val, err := decode(register, buff)
+	if nil != err {
+		return nil, math.NaN(), err
+	}
+	if text, ok := val.(string); ok {
+		return text, 0, nil
+	}
+	f, err := util.ToFloat64(val)
+	if nil != err {
+		return val, math.NaN(), err
+	}
+	v, err := register.ToValue(f)
+	if nil != err {
+		return val, math.NaN(), fmt.Errorf("read: %w", err)
+	}
+	return val, v, nil
+}
+func (c *modbusClient) ReadRef(reference string) (raw any, value float64, title string, err error) {
 	reg, err := c.config.FindRegister(reference)
 	if nil != err {
-		return 0, 0, "", err
+		return nil, 0, "", err
 	}
 	r, v, e := c.Read(reg)
 	return r, v, reg.Title, e
@@ -97,18 +145,71 @@ func (c *modbusClient) ReadRef(reference string) (raw uint32, value float64, tit
 // endregion
 // region ~> write
 
-func (c *modbusClient) Write(register *model.Register, value uint16) (err error) {
-	f := c.getWriterFunction(register)
-	if register.Type == model.COIL && value > 0 {
-		value = 0xFF00
+// Write encodes a value of register's data type & writes it, using multi-register write for multi-word values
+
+func (c *modbusClient) Write(register *model.Register, value any) (err error) {
+	if register.IsBit() {
+		v, err := util.ToFloat64(value)
+		if nil != err {
+			return err
+		}
+		var word uint16
+		if v != 0 {
+			word = 0xFF00
+		}
+		return c.writeSingle(register, word)
 	}
-	buff, err := f(register.Device.SlaveId, register.Address, value)
-	if nil == err {
-		c.logger.Info("write response: % x", buff)
+	data, err := encode(register, value)
+	if nil != err {
+		return err
+	}
+	if len(data) == 2 {
+		return c.writeSingle(register, binary.BigEndian.Uint16(data))
+	}
+	return c.writeMultiple(register, uint16(len(data)/2), data)
+}
+
+// WriteMultiple writes a block of values of register's data type starting at register's address
+// in one request: coils are written with FC 15, holding registers with FC 16
+
+func (c *modbusClient) WriteMultiple(register *model.Register, values []any) (err error) {
+	if 0 == len(values) {
+		return errors.New("write: no values to write")
+	}
+	switch register.Type {
+	case model.COIL:
+		if len(values) > int(register.Size) {
+			return fmt.Errorf("write: %d coils do not fit register of size %d", len(values), register.Size)
+		}
+		data := make([]byte, (len(values)+7)/8)
+		for i, value := range values {
+			v, err := util.ToFloat64(value)
+			if nil != err {
+				return err
+			}
+			if v != 0 {
+				data[i/8] |= 1 << (i % 8)
+			}
+		}
+		return c.writeMultiple(register, uint16(len(values)), data)
+	case model.HOLDING:
+		var data []byte
+		for _, value := range values {
+			b, err := encode(register, value)
+			if nil != err {
+				return err
+			}
+			data = append(data, b...)
+		}
+		if len(data)/2 > int(register.Size) {
+			return fmt.Errorf("write: %d words do not fit register of size %d", len(data)/2, register.Size)
+		}
+		return c.writeMultiple(register, uint16(len(data)/2), data)
+	default:
+		return fmt.Errorf("invalid register type used for data write: %s", register.Type)
 	}
-	return err
 }
-func (c *modbusClient) WriteRef(reference string, value uint16) (err error) {
+func (c *modbusClient) WriteRef(reference string, value any) (err error) {
 	reg, err := c.config.FindRegister(reference)
 	if nil != err {
 		return err
@@ -119,6 +220,31 @@ func (c *modbusClient) WriteRef(reference string, value uint16) (err error) {
 	return c.Write(reg, value)
 }
 
+// endregion
+// region ~> passthrough
+
+func (c *modbusClient) Send(slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	aduRequest, err := c.handler.Encode(slaveId, request)
+	if nil != err {
+		return nil, err
+	}
+	aduResponse, err := c.handler.Send(aduRequest)
+	if nil != err {
+		return nil, err
+	}
+	if err = c.handler.Verify(aduRequest, aduResponse); nil != err {
+		return nil, err
+	}
+	return c.handler.Decode(aduResponse)
+}
+
+// endregion
+// region ~> settings
+
+func (c *modbusClient) SetTimeout(timeout time.Duration) {
+	setHandlerTimeout(c.handler, positiveOrDefault(timeout, c.timeout))
+}
+
 // endregion
 // endregion
 // region - private methods
@@ -135,16 +261,48 @@ func (c *modbusClient) getReaderFunction(register *model.Register) func(slaveId
 		return (*c.client).ReadHoldingRegisters
 	}
 }
-func (c *modbusClient) getWriterFunction(register *model.Register) func(slaveId uint8, address, value uint16) (results []byte, err error) {
+func (c *modbusClient) getWriterFunction(register *model.Register) (func(slaveId uint8, address, value uint16) (results []byte, err error), error) {
 	switch register.Type {
 	case model.COIL:
-		return (*c.client).WriteSingleCoil
+		return (*c.client).WriteSingleCoil, nil
 	case model.HOLDING:
-		return (*c.client).WriteSingleRegister
+		return (*c.client).WriteSingleRegister, nil
 	default:
-		panic(fmt.Sprintf("invalid register type used for data write: %s", register.Type))
+		return nil, fmt.Errorf("invalid register type used for data write: %s", register.Type)
 	}
 }
+func (c *modbusClient) getMultipleWriterFunction(register *model.Register) (func(slaveId uint8, address, quantity uint16, value []byte) (results []byte, err error), error) {
+	switch register.Type {
+	case model.COIL:
+		return (*c.client).WriteMultipleCoils, nil
+	case model.HOLDING:
+		return (*c.client).WriteMultipleRegisters, nil
+	default:
+		return nil, fmt.Errorf("invalid register type used for data write: %s", register.Type)
+	}
+}
+func (c *modbusClient) writeSingle(register *model.Register, value uint16) error {
+	f, err := c.getWriterFunction(register)
+	if nil != err {
+		return err
+	}
+	buff, err := f(register.Device.SlaveId, register.Address, value)
+	if nil == err {
+		c.logger.Info("write response: % x", buff)
+	}
+	return err
+}
+func (c *modbusClient) writeMultiple(register *model.Register, quantity uint16, data []byte) error {
+	f, err := c.getMultipleWriterFunction(register)
+	if nil != err {
+		return err
+	}
+	buff, err := f(register.Device.SlaveId, register.Address, quantity, data)
+	if nil == err {
+		c.logger.Info("write response: % x", buff)
+	}
+	return err
+}
 
 // endregion
 
@@ -0,0 +1,126 @@
+package bridge
+
+import (
+	"mbridge/model"
+	"mbridge/util"
+	"sync"
+	"time"
+)
+
+// DeviceMonitor tracks devices' availability from the outcome of commands sent to them
+type DeviceMonitor interface {
+	// Report records the outcome of a command executed on the device
+	Report(device *model.Device, err error)
+	// Available reports whether the device should be polled now: online devices always are,
+	// offline ones only once their probe is due, which also schedules the next probe
+	Available(device *model.Device, now time.Time) (poll bool, probe bool)
+	// States returns availability of the channel's devices
+	States() []model.DeviceState
+}
+
+type deviceHealth struct {
+	failures  int
+	offline   bool
+	since     time.Time
+	backoff   time.Duration
+	nextProbe time.Time
+	lastError error
+}
+
+type deviceMonitorImpl struct {
+	channel    *model.Channel
+	threshold  int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	devices    map[*model.Device]*deviceHealth
+	logger     util.Logger
+	mutex      sync.Mutex
+}
+
+func CreateDeviceMonitor(channel *model.Channel) DeviceMonitor {
+	backoff, maxBackoff := channel.GetOfflineBackoff()
+	return &deviceMonitorImpl{
+		channel:    channel,
+		threshold:  channel.GetOfflineThreshold(),
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		devices:    make(map[*model.Device]*deviceHealth),
+		logger:     util.GetLogger("monitor"),
+	}
+}
+
+func (m *deviceMonitorImpl) Report(device *model.Device, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	h := m.health(device)
+	// only a missing answer counts: a device replying with an exception is alive
+	if err == nil || !IsUnreachable(err) {
+		if h.offline {
+			m.logger.Info("device %s:%s is back online", m.channel.Title, device.Title)
+			h.offline = false
+			h.since = time.Now()
+		}
+		h.failures = 0
+		h.lastError = nil
+		return
+	}
+	h.failures++
+	h.lastError = err
+	if !h.offline && h.failures >= m.threshold {
+		m.logger.Warning("device %s:%s is offline after %d failures: %v", m.channel.Title, device.Title, h.failures, err)
+		h.offline = true
+		h.since = time.Now()
+		h.backoff = m.backoff
+		h.nextProbe = h.since.Add(h.backoff)
+	}
+}
+func (m *deviceMonitorImpl) Available(device *model.Device, now time.Time) (poll bool, probe bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	h := m.health(device)
+	if !h.offline {
+		return true, false
+	}
+	if now.Before(h.nextProbe) {
+		return false, false
+	}
+	h.backoff = min(2*h.backoff, m.maxBackoff)
+	h.nextProbe = now.Add(h.backoff)
+	m.logger.Debug("probing offline device %s:%s, next probe in %s", m.channel.Title, device.Title, h.backoff)
+	return true, true
+}
+func (m *deviceMonitorImpl) States() []model.DeviceState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var result []model.DeviceState
+	for i := range m.channel.Devices {
+		d := &m.channel.Devices[i]
+		h := m.health(d)
+		state := model.DeviceState{
+			Channel:  m.channel.Title,
+			Device:   d.Title,
+			Alias:    d.Alias,
+			Online:   !h.offline,
+			Failures: h.failures,
+			Since:    h.since,
+		}
+		if h.offline {
+			next := h.nextProbe
+			state.NextProbe = &next
+		}
+		if h.lastError != nil {
+			state.LastError = h.lastError.Error()
+		}
+		result = append(result, state)
+	}
+	return result
+}
+
+func (m *deviceMonitorImpl) health(device *model.Device) *deviceHealth {
+	h, ok := m.devices[device]
+	if !ok {
+		h = &deviceHealth{since: time.Now()}
+		m.devices[device] = h
+	}
+	return h
+}
@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"github.com/mvkvl/modbus"
+	"mbridge/model/modeltest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeviceMonitorOffline(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "offline": {"threshold": 2, "backoff": "1s", "max_backoff": "3s"},
+		"devices": [{"title": "d", "slave_id": 1, "registers": [{"title": "r", "type": "holding"}]}]}]}`)
+	device := &config.Channels[0].Devices[0]
+	monitor := CreateDeviceMonitor(&config.Channels[0])
+	timeout := os.ErrDeadlineExceeded
+
+	// an exception is an answer, it does not count as failure
+	monitor.Report(device, &modbus.ModbusError{FunctionCode: 3, ExceptionCode: modbus.ExceptionCodeIllegalDataAddress})
+	monitor.Report(device, timeout)
+	if poll, _ := monitor.Available(device, time.Now()); !poll || !monitor.States()[0].Online {
+		t.Fatal("expected device to stay online below threshold")
+	}
+	monitor.Report(device, timeout)
+	state := monitor.States()[0]
+	if state.Online || state.NextProbe == nil {
+		t.Fatal("expected device to be offline")
+	}
+
+	// probes back off exponentially up to the maximum
+	now := time.Now()
+	if poll, _ := monitor.Available(device, now); poll {
+		t.Error("expected offline device not to be polled before probe is due")
+	}
+	var pauses []time.Duration
+	for range 3 {
+		now = *monitor.States()[0].NextProbe
+		if poll, probe := monitor.Available(device, now); !poll || !probe {
+			t.Fatal("expected offline device to be probed")
+		}
+		pauses = append(pauses, monitor.States()[0].NextProbe.Sub(now))
+	}
+	if pauses[0] != 2*time.Second || pauses[1] != 3*time.Second || pauses[2] != 3*time.Second {
+		t.Errorf("unexpected probe back-off: %v", pauses)
+	}
+
+	monitor.Report(device, nil)
+	if state := monitor.States()[0]; !state.Online || state.Failures != 0 {
+		t.Errorf("expected device to be back online, got %+v", state)
+	}
+	if poll, probe := monitor.Available(device, now); !poll || probe {
+		t.Error("expected online device to be polled")
+	}
+}
@@ -0,0 +1,49 @@
+package bridge
+
+import (
+	"errors"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"mbridge/server"
+)
+
+type passthroughTarget struct {
+	channel string
+	slaveId uint8
+}
+
+// passthroughImpl serves the passthrough listener: requests are sent to the mapped slaves through
+// the channels' queues, so they are interleaved with polling instead of colliding with it on the bus
+type passthroughImpl struct {
+	bridge Bridge
+	units  map[uint8]passthroughTarget
+}
+
+func CreatePassthrough(config *model.Config, bridge Bridge) server.Handler {
+	p := &passthroughImpl{
+		bridge: bridge,
+		units:  make(map[uint8]passthroughTarget),
+	}
+	for _, u := range config.Passthrough.Units {
+		p.units[u.UnitId] = passthroughTarget{u.Channel, u.SlaveId}
+	}
+	return p
+}
+
+func (p *passthroughImpl) Handle(unitId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	target, ok := p.units[unitId]
+	if !ok {
+		return nil, exception(modbus.ExceptionCodeGatewayPathUnavailable)
+	}
+	response, err := p.bridge.Passthrough(target.channel, target.slaveId, request)
+	switch {
+	case err == nil:
+		return response, nil
+	case errors.Is(err, ErrNotFound):
+		return nil, exception(modbus.ExceptionCodeGatewayPathUnavailable)
+	case errors.Is(err, ErrQueueFull):
+		return nil, exception(modbus.ExceptionCodeServerDeviceBusy)
+	default:
+		return nil, exception(modbus.ExceptionCodeGatewayTargetDeviceFailedToRespond)
+	}
+}
@@ -0,0 +1,74 @@
+package bridge
+
+import (
+	"github.com/mvkvl/modbus"
+	"mbridge/model/modeltest"
+	"mbridge/server"
+	"testing"
+	"time"
+)
+
+// slaveClient answers holding register reads with the slave id, slave 9 with an exception
+type slaveClient struct {
+	ModbusClient
+}
+
+func (c *slaveClient) Send(slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	if 9 == slaveId {
+		return &modbus.ProtocolDataUnit{FunctionCode: request.FunctionCode | 0x80, Data: []byte{modbus.ExceptionCodeIllegalFunction}}, nil
+	}
+	return &modbus.ProtocolDataUnit{FunctionCode: request.FunctionCode, Data: []byte{2, 0, slaveId}}, nil
+}
+func (c *slaveClient) SetTimeout(timeout time.Duration) {
+}
+
+// commanderBridge passes requests through to the channel's commander
+type commanderBridge struct {
+	Bridge
+	commander Commander
+}
+
+func (b *commanderBridge) Passthrough(channel string, slaveId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	return b.commander.Passthrough(slaveId, request)
+}
+
+func TestPassthrough(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "devices": [
+		{"title": "d", "slave_id": 1, "registers": [{"title": "r", "type": "holding"}]}]}],
+		"passthrough": {"units": [{"unit_id": 5, "channel": "c", "slave_id": 1}, {"unit_id": 6, "channel": "c", "slave_id": 9}]}}`)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	channel := &config.Channels[0]
+	readCmdChn, queryCmdChn, writeCmdChn, modbusChn := make(chan Command), make(chan Command), make(chan Command), make(chan Command)
+	demultiplexer := CreateDemultiplexer(readCmdChn, queryCmdChn, writeCmdChn, modbusChn, channel)
+	executor := CreateExecutor(modbusChn, &slaveClient{}, CreateMetricCache(time.Minute), CreateDeviceMonitor(channel))
+	demultiplexer.Start("c")
+	executor.Start("c")
+	defer demultiplexer.Stop("c")
+	defer executor.Stop("c")
+
+	br := &commanderBridge{commander: CreateCommander(writeCmdChn, queryCmdChn, channel, config)}
+	srv := server.CreateServer("127.0.0.1:0", CreatePassthrough(config, br))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer srv.Stop()
+	handler := modbus.NewTCPClientHandler(srv.Addr().String())
+	handler.Timeout = time.Second
+	defer handler.Close()
+	client := modbus.NewClient(handler)
+
+	for i := 0; i < 3; i++ {
+		if results, err := client.ReadHoldingRegisters(5, 0, 1); err != nil || "\x00\x01" != string(results) {
+			t.Errorf("expected answer of slave 1, got '% x' (%v)", results, err)
+		}
+	}
+	// device's exceptions are passed back, unmapped units are reported as unavailable gateway path
+	if _, err := client.ReadHoldingRegisters(6, 0, 1); !isException(err, modbus.ExceptionCodeIllegalFunction) {
+		t.Errorf("expected illegal function exception, got '%v'", err)
+	}
+	if _, err := client.ReadHoldingRegisters(7, 0, 1); !isException(err, modbus.ExceptionCodeGatewayPathUnavailable) {
+		t.Errorf("expected gateway path exception, got '%v'", err)
+	}
+}
@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"mbridge/model"
+	"slices"
+)
+
+// planReads groups registers into blocks which can each be read with a single request:
+// registers of the same slave and type, at most channel's max read gap apart, with the
+// whole block not exceeding channel's max read block quantity
+func planReads(channel *model.Channel, registers []*model.Register) [][]*model.Register {
+	sorted := slices.Clone(registers)
+	slices.SortStableFunc(sorted, func(a, b *model.Register) int {
+		if a.Device.SlaveId != b.Device.SlaveId {
+			return int(a.Device.SlaveId) - int(b.Device.SlaveId)
+		}
+		if a.Type != b.Type {
+			return int(a.Type) - int(b.Type)
+		}
+		return int(a.Address) - int(b.Address)
+	})
+	var result [][]*model.Register
+	var block []*model.Register
+	var start, end int
+	for _, r := range sorted {
+		rStart, rEnd := int(r.Address), int(r.Address)+int(r.Size)
+		if len(block) > 0 &&
+			block[0].Device.SlaveId == r.Device.SlaveId &&
+			block[0].Type == r.Type &&
+			rStart <= end+int(channel.GetMaxReadGap()) &&
+			max(end, rEnd)-start <= int(channel.GetMaxReadBlock(r.Type)) {
+			block = append(block, r)
+			end = max(end, rEnd)
+			continue
+		}
+		if len(block) > 0 {
+			result = append(result, block)
+		}
+		block = []*model.Register{r}
+		start, end = rStart, rEnd
+	}
+	if len(block) > 0 {
+		result = append(result, block)
+	}
+	return result
+}
+
+// blockSpan returns the start address and quantity covering all registers of the block
+func blockSpan(registers []*model.Register) (address, quantity uint16) {
+	start, end := int(registers[0].Address), int(registers[0].Address)+int(registers[0].Size)
+	for _, r := range registers[1:] {
+		start = min(start, int(r.Address))
+		end = max(end, int(r.Address)+int(r.Size))
+	}
+	return uint16(start), uint16(end - start)
+}
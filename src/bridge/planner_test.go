@@ -0,0 +1,78 @@
+package bridge
+
+import (
+	"bytes"
+	"mbridge/model"
+	"testing"
+)
+
+func testRegisters(device *model.Device, specs ...[3]int) []*model.Register {
+	var result []*model.Register
+	for _, s := range specs {
+		result = append(result, &model.Register{Device: device, Type: model.RegType(s[0]), Address: uint16(s[1]), Size: uint16(s[2])})
+	}
+	return result
+}
+func TestPlanReadsContiguous(t *testing.T) {
+	device := &model.Device{SlaveId: 12}
+	channel := &model.Channel{}
+	registers := testRegisters(device,
+		[3]int{int(model.INPUT), 5, 1},
+		[3]int{int(model.INPUT), 0, 1},
+		[3]int{int(model.INPUT), 1, 1},
+		[3]int{int(model.INPUT), 9, 2},
+		[3]int{int(model.INPUT), 8, 1},
+		[3]int{int(model.COIL), 2, 1},
+	)
+	blocks := planReads(channel, registers)
+	if 4 != len(blocks) {
+		t.Fatalf("expected 4 blocks, got %d instead", len(blocks))
+	}
+	exp := [][2]uint16{{2, 1}, {0, 2}, {5, 1}, {8, 3}}
+	for i, block := range blocks {
+		address, quantity := blockSpan(block)
+		if exp[i][0] != address || exp[i][1] != quantity {
+			t.Errorf("block %d: expected [%d+%d], got [%d+%d] instead", i, exp[i][0], exp[i][1], address, quantity)
+		}
+	}
+}
+func TestPlanReadsGapAndLimit(t *testing.T) {
+	device := &model.Device{SlaveId: 12}
+	gap, block := uint16(3), uint16(8)
+	channel := &model.Channel{MaxReadGap: &gap, MaxReadBlock: &block}
+	registers := testRegisters(device,
+		[3]int{int(model.INPUT), 0, 1},
+		[3]int{int(model.INPUT), 4, 1},
+		[3]int{int(model.INPUT), 7, 2},
+		[3]int{int(model.INPUT), 11, 1},
+	)
+	blocks := planReads(channel, registers)
+	if 2 != len(blocks) {
+		t.Fatalf("expected 2 blocks, got %d instead", len(blocks))
+	}
+	if address, quantity := blockSpan(blocks[0]); 0 != address || 5 != quantity {
+		t.Errorf("expected [0+5], got [%d+%d] instead", address, quantity)
+	}
+	if address, quantity := blockSpan(blocks[1]); 7 != address || 5 != quantity {
+		t.Errorf("expected [7+5], got [%d+%d] instead", address, quantity)
+	}
+}
+func TestPlanReadsSeparateSlaves(t *testing.T) {
+	channel := &model.Channel{}
+	registers := append(
+		testRegisters(&model.Device{SlaveId: 11}, [3]int{int(model.INPUT), 0, 1}),
+		testRegisters(&model.Device{SlaveId: 12}, [3]int{int(model.INPUT), 1, 1})...,
+	)
+	if blocks := planReads(channel, registers); 2 != len(blocks) {
+		t.Errorf("expected 2 blocks, got %d instead", len(blocks))
+	}
+}
+func TestSliceBits(t *testing.T) {
+	res, err := sliceBits([]byte{0b10110100, 0b00000001}, 2, 7)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp := []byte{0b01101101}; !bytes.Equal(exp, res) {
+		t.Errorf("expected '%08b', got '%08b' instead", exp, res)
+	}
+}
@@ -7,26 +7,52 @@ import (
 	"time"
 )
 
+const (
+	// idlePollWait is how long the poller sleeps when there is nothing left to poll
+	idlePollWait = time.Second
+	// defaultOnceRetry is how long a register read once waits to be read again, if its value is not cached
+	defaultOnceRetry = 10 * time.Second
+)
+
 type Poller interface {
 	Start(title string)
 	Stop(title string)
 }
 
+// pollEntry is a register's place in the poll schedule
+type pollEntry struct {
+	device   *model.Device
+	register *model.Register
+	interval time.Duration
+	once     bool
+	done     bool
+	due      time.Time
+}
+
 type pollerImpl struct {
 	stopped    bool
 	channel    *model.Channel
+	config     *model.Config
+	schedule   []*pollEntry
 	readCmdChn chan<- Command
+	monitor    DeviceMonitor
+	cache      MetricCache
+	onceRetry  time.Duration
 	quitChn    chan struct{}
 	logger     util.Logger
 	started    bool
 	mutex      sync.Mutex
 }
 
-func CreatePoller(readCmdChn chan Command, channel *model.Channel) Poller {
+func CreatePoller(readCmdChn chan Command, channel *model.Channel, config *model.Config, monitor DeviceMonitor, cache MetricCache) Poller {
 	return &pollerImpl{
 		stopped:    false,
 		readCmdChn: readCmdChn,
 		channel:    channel,
+		config:     config,
+		monitor:    monitor,
+		cache:      cache,
+		onceRetry:  defaultOnceRetry,
 		logger:     util.GetLogger("poller"),
 	}
 }
@@ -38,7 +64,9 @@ func (p *pollerImpl) Start(title string) {
 		return
 	}
 	p.started = true
+	p.stopped = false
 	p.quitChn = make(chan struct{})
+	p.schedule = p.createSchedule()
 
 	go func() {
 		p.logger.Info("start poller %s", title)
@@ -48,7 +76,7 @@ func (p *pollerImpl) Start(title string) {
 		}()
 		for {
 			select {
-			case <-time.After(time.Second):
+			case <-time.After(p.nextWait()):
 				p.cycle()
 			case <-p.quitChn:
 				p.stopped = true
@@ -71,26 +99,130 @@ func (p *pollerImpl) Stop(title string) {
 	p.quitChn <- struct{}{}
 }
 
+// createSchedule lists readable registers of the channel, all due immediately
+func (p *pollerImpl) createSchedule() []*pollEntry {
+	var result []*pollEntry
+	now := time.Now()
+	for i := range p.channel.Devices {
+		d := &p.channel.Devices[i]
+		for j := range d.Registers {
+			r := &d.Registers[j]
+			if r.Mode != model.RO && r.Mode != model.RW {
+				continue
+			}
+			interval, once, err := p.config.GetPollInterval(r)
+			if err != nil {
+				p.logger.Warning("register %s will not be polled: %v", model.MetricKey(r), err)
+				continue
+			}
+			result = append(result, &pollEntry{device: d, register: r, interval: interval, once: once, due: now})
+		}
+	}
+	return result
+}
+
+// nextWait returns the time left until the earliest deadline of the schedule
+func (p *pollerImpl) nextWait() time.Duration {
+	var next time.Time
+	for _, e := range p.schedule {
+		if !e.done && (next.IsZero() || e.due.Before(next)) {
+			next = e.due
+		}
+	}
+	if next.IsZero() {
+		return idlePollWait
+	}
+	return max(0, time.Until(next))
+}
+
+// cycle sends read commands for registers whose deadline has passed, device by device
 func (p *pollerImpl) cycle() {
-	p.logger.Debug("polling channel %s (%d devices)", p.channel.Title, len(p.channel.Devices))
-	for _, d := range p.channel.Devices {
+	now := time.Now()
+	var devices []*model.Device
+	due := make(map[*model.Device][]*pollEntry)
+	for _, e := range p.schedule {
+		if e.once && !e.done && nil != p.cache.Get(model.MetricKey(e.register)) {
+			// read once registers are done only when their value made it to the cache
+			e.done = true
+		}
+		if e.done || e.due.After(now) {
+			continue
+		}
+		if _, ok := due[e.device]; !ok {
+			devices = append(devices, e.device)
+		}
+		due[e.device] = append(due[e.device], e)
+	}
+	p.logger.Debug("polling channel %s (%d devices due)", p.channel.Title, len(devices))
+	for _, d := range devices {
 		if p.stopped {
 			p.logger.Debug("polling disabled; exit")
 			break
 		}
+		poll, probe := p.monitor.Available(d, now)
+		if !poll {
+			p.logger.Trace("skipping offline device: %s:%s", p.channel.Title, d.Title)
+			for _, e := range due[d] {
+				p.postpone(e, now)
+			}
+			continue
+		}
+		var registers []*model.Register
+		for _, e := range due[d] {
+			registers = append(registers, e.register)
+		}
+		blocks := planReads(p.channel, registers)
+		if probe && len(blocks) > 1 {
+			// an offline device is probed with a single read instead of timing out on all of its registers
+			blocks = blocks[:1]
+		}
+		sent := make(map[*model.Register]bool)
+		for _, block := range blocks {
+			for _, r := range block {
+				sent[r] = true
+			}
+		}
+		for _, e := range due[d] {
+			if sent[e.register] {
+				p.reschedule(e, now)
+			} else {
+				p.postpone(e, now)
+			}
+		}
 		p.logger.Debug("polling device: %s:%s", p.channel.Title, d.Title)
-		for _, r := range d.Registers {
+		for _, block := range blocks {
 			if p.stopped {
 				break
 			}
-			if r.Mode == model.RO || r.Mode == model.RW {
-				cmd := NewReadCommand(p.channel, &d, &r)
-				p.logger.Trace("polling register: %s:%s:%s", cmd.GetChannel().Title, cmd.GetDevice().Title, cmd.GetRegister().Title)
-				p.readCmdChn <- cmd
-				p.logger.Trace("sent read command for: %s:%s:%s", cmd.GetChannel().Title, cmd.GetDevice().Title, cmd.GetRegister().Title)
-			}
+			cmd := NewBlockReadCommand(p.channel, d, block)
+			address, quantity := blockSpan(block)
+			p.logger.Trace("polling registers: %s:%s [%d+%d] (%d registers)", cmd.GetChannel().Title, cmd.GetDevice().Title, address, quantity, len(block))
+			p.readCmdChn <- cmd
+			p.logger.Trace("sent read command for: %s:%s [%d+%d]", cmd.GetChannel().Title, cmd.GetDevice().Title, address, quantity)
 			time.Sleep(p.channel.GetRegisterPause())
 		}
 		time.Sleep(p.channel.GetCyclePause())
 	}
 }
+
+// reschedule moves register's deadline by its interval, without catching up on missed deadlines;
+// a register read once is due again after a while, in case its read fails
+func (p *pollerImpl) reschedule(e *pollEntry, now time.Time) {
+	if e.once {
+		e.due = now.Add(p.onceRetry)
+		return
+	}
+	e.due = e.due.Add(e.interval)
+	if e.due.Before(now) {
+		e.due = now.Add(e.interval)
+	}
+}
+
+// postpone moves deadline of a register which was not polled, keeping read-once registers pending
+func (p *pollerImpl) postpone(e *pollEntry, now time.Time) {
+	if e.once {
+		e.due = now.Add(idlePollWait)
+		return
+	}
+	p.reschedule(e, now)
+}
@@ -0,0 +1,40 @@
+package bridge
+
+import (
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"testing"
+	"time"
+)
+
+func TestPollerReadOnce(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "cycle_pause": "1ms", "devices": [{"title": "d", "slave_id": 1, "registers": [
+		{"title": "serial", "type": "input", "poll_class": "once"}]}]}]}`)
+	channel := &config.Channels[0]
+	readCmdChn := make(chan Command)
+	cache := CreateChannelCache(channel, config)
+	poller := CreatePoller(readCmdChn, channel, config, CreateDeviceMonitor(channel), cache).(*pollerImpl)
+	poller.onceRetry = 50 * time.Millisecond
+	poller.Start("c")
+	defer poller.Stop("c")
+
+	receive := func() Command {
+		select {
+		case cmd := <-readCmdChn:
+			return cmd
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected a read command")
+		}
+		return nil
+	}
+	// a failed read leaves no value in the cache, the register is read again
+	receive()
+	cmd := receive()
+	register := cmd.GetRegister()
+	cache.Set(model.MetricKey(register), newMetric(register, model.MetricKey(register), uint16(42), 42))
+	select {
+	case <-readCmdChn:
+		t.Error("expected register not to be read once its value is cached")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -1,12 +1,10 @@
 package bridge
 
 import (
-	"github.com/mvkvl/modbus"
 	"mbridge/model"
 	"mbridge/util"
 	"strings"
 	"sync"
-	"time"
 )
 
 type ChannelProcessor interface {
@@ -14,15 +12,20 @@ type ChannelProcessor interface {
 	Stop()
 	Commander() Commander
 	Cache() MetricCache
+	Monitor() DeviceMonitor
+	State() model.ChannelState
 }
 
 type channelProcessorImpl struct {
 	channelTitle  string
+	channel       *model.Channel
+	handler       *failoverHandler
 	commander     Commander
 	poller        Poller
 	demultiplexer Demultiplexer
 	executor      Executor
 	cache         MetricCache
+	monitor       DeviceMonitor
 	logger        util.Logger
 	started       bool
 	mutex         sync.Mutex
@@ -31,48 +34,27 @@ type channelProcessorImpl struct {
 func CreateProcessor(channel *model.Channel, config *model.Config) ChannelProcessor {
 
 	readCmdQueue := make(chan Command)
+	queryCmdQueue := make(chan Command)
 	writeCmdQueue := make(chan Command)
 	modbusCmdQueue := make(chan Command)
 
-	modbusClient := createModbusClient(createModbusHandlerFactory, channel, config)
-	cache := CreateMetricCache(config.GetTTL())
+	modbusClient, handler := createModbusClient(createModbusHandlerFactory, channel, config)
+	cache := CreateChannelCache(channel, config)
+	monitor := CreateDeviceMonitor(channel)
 	channelTitle := strings.ToLower(channel.Title)
 	return &channelProcessorImpl{
 		channelTitle:  channelTitle,
+		channel:       channel,
+		handler:       handler,
 		logger:        util.GetLogger("processor-" + channelTitle),
-		demultiplexer: CreateDemultiplexer(readCmdQueue, writeCmdQueue, modbusCmdQueue),
-		executor:      CreateExecutor(modbusCmdQueue, modbusClient, cache),
-		poller:        CreatePoller(readCmdQueue, channel),
-		commander:     CreateCommander(writeCmdQueue, channel, config),
+		demultiplexer: CreateDemultiplexer(readCmdQueue, queryCmdQueue, writeCmdQueue, modbusCmdQueue, channel),
+		executor:      CreateExecutor(modbusCmdQueue, modbusClient, cache, monitor),
+		poller:        CreatePoller(readCmdQueue, channel, config, monitor, cache),
+		commander:     CreateCommander(writeCmdQueue, queryCmdQueue, channel, config),
 		cache:         cache,
+		monitor:       monitor,
 	}
 }
-func createModbusClient(handlerFactory func(connection string, mode model.Mode) modbus.ClientHandler,
-	channel *model.Channel, config *model.Config) ModbusClient {
-	handler := handlerFactory(channel.Connection, channel.Mode)
-	client := modbus.NewClient(handler)
-	return NewModbusClient(config, &client)
-}
-func createModbusHandlerFactory(connection string, mode model.Mode) modbus.ClientHandler {
-	switch mode {
-	case model.ENC:
-		_handler := modbus.NewEncClientHandler(connection)
-		_handler.IdleTimeout = 2 * time.Second
-		_handler.Timeout = 1 * time.Second
-		//_handler.Logger = log.New(os.Stdout, fmt.Sprintf("[%s]: ", connection), log.LstdFlags|log.Lmicroseconds)
-		return _handler
-	case model.TCP:
-		_handler := modbus.NewTCPClientHandler(connection)
-		//_handler.Logger = log.New(os.Stdout, fmt.Sprintf("[%s]: ", connection), log.LstdFlags|log.Lmicroseconds)
-		return _handler
-	case model.RTU:
-		_handler := modbus.NewRTUClientHandler(connection)
-		//_handler.Logger = log.New(os.Stdout, fmt.Sprintf("[%s]: ", connection), log.LstdFlags|log.Lmicroseconds)
-		return _handler
-	}
-	return nil
-}
-
 func (p *channelProcessorImpl) Start() {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -101,6 +83,21 @@ func (p *channelProcessorImpl) Stop() {
 func (p *channelProcessorImpl) Cache() MetricCache {
 	return p.cache
 }
+
+// State reports which of channel's connections is in use
+func (p *channelProcessorImpl) State() model.ChannelState {
+	endpoint := p.handler.Endpoint()
+	return model.ChannelState{
+		Channel:   p.channel.Title,
+		Mode:      p.channel.Mode,
+		Endpoint:  endpoint,
+		Primary:   endpoint == p.handler.Endpoints()[0],
+		Endpoints: p.handler.Endpoints(),
+	}
+}
+func (p *channelProcessorImpl) Monitor() DeviceMonitor {
+	return p.monitor
+}
 func (p *channelProcessorImpl) Commander() Commander {
 	return p.commander
 }
@@ -0,0 +1,224 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mvkvl/modbus"
+	"math/rand"
+	"mbridge/model"
+	"mbridge/server"
+	"os"
+	"sync"
+	"time"
+)
+
+var errNoSlave = errors.New("no such slave")
+
+// simRegister is a register of a simulated slave; a written register holds the written value
+type simRegister struct {
+	register *model.Register
+	value    float64
+	written  bool
+}
+
+type simSlave struct {
+	registers []*simRegister
+	words     map[model.RegType]map[uint16]uint16
+	bits      map[model.RegType]map[uint16]bool
+}
+
+// Simulator is an in-memory Modbus slave for every slave id of a channel's devices: it holds
+// registers' contents, which are seeded by registers' generators & changed by writes; addresses
+// no register is configured at read as zero
+type Simulator struct {
+	slaves map[uint8]*simSlave
+	start  time.Time
+	random *rand.Rand
+	mutex  sync.Mutex
+}
+
+func NewSimulator(channel *model.Channel) *Simulator {
+	s := &Simulator{
+		slaves: make(map[uint8]*simSlave),
+		start:  time.Now(),
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for i := range channel.Devices {
+		d := &channel.Devices[i]
+		slave, ok := s.slaves[d.SlaveId]
+		if !ok {
+			slave = &simSlave{
+				words: make(map[model.RegType]map[uint16]uint16),
+				bits:  make(map[model.RegType]map[uint16]bool),
+			}
+			for _, t := range []model.RegType{model.COIL, model.DISCRETE, model.INPUT, model.HOLDING} {
+				slave.words[t] = make(map[uint16]uint16)
+				slave.bits[t] = make(map[uint16]bool)
+			}
+			s.slaves[d.SlaveId] = slave
+		}
+		for j := range d.Registers {
+			r := &simRegister{register: &d.Registers[j]}
+			if nil != r.register.Sim {
+				r.value = r.register.Sim.Value
+			}
+			slave.registers = append(slave.registers, r)
+			s.store(slave, r)
+		}
+	}
+	return s
+}
+
+func (s *Simulator) ReadBits(unitId uint8, table model.RegType, address, quantity uint16) ([]bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	slave, err := s.refresh(unitId, table, address, quantity)
+	if err != nil {
+		return nil, err
+	}
+	bits := make([]bool, quantity)
+	for i := range bits {
+		bits[i] = slave.bits[table][address+uint16(i)]
+	}
+	return bits, nil
+}
+func (s *Simulator) ReadWords(unitId uint8, table model.RegType, address, quantity uint16) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	slave, err := s.refresh(unitId, table, address, quantity)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, 2*quantity)
+	for i := uint16(0); i < quantity; i++ {
+		data = binary.BigEndian.AppendUint16(data, slave.words[table][address+i])
+	}
+	return data, nil
+}
+func (s *Simulator) WriteBits(unitId uint8, address uint16, values []bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	slave, ok := s.slaves[unitId]
+	if !ok {
+		return errNoSlave
+	}
+	for i, v := range values {
+		slave.bits[model.COIL][address+uint16(i)] = v
+	}
+	s.hold(slave, model.COIL, address, uint16(len(values)))
+	return nil
+}
+func (s *Simulator) WriteWords(unitId uint8, address uint16, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	slave, ok := s.slaves[unitId]
+	if !ok {
+		return errNoSlave
+	}
+	for i := 0; i+1 < len(data); i += 2 {
+		slave.words[model.HOLDING][address+uint16(i/2)] = binary.BigEndian.Uint16(data[i:])
+	}
+	s.hold(slave, model.HOLDING, address, uint16(len(data)/2))
+	return nil
+}
+
+// refresh moves generated values of slave's registers within the range to the current ones
+func (s *Simulator) refresh(unitId uint8, table model.RegType, address, quantity uint16) (*simSlave, error) {
+	slave, ok := s.slaves[unitId]
+	if !ok {
+		return nil, errNoSlave
+	}
+	elapsed := time.Since(s.start)
+	for _, r := range slave.registers {
+		sim := r.register.Sim
+		if nil == sim || r.written || !overlaps(r.register, table, address, quantity) {
+			continue
+		}
+		if sim.Generator == model.RANDOM_WALK {
+			r.value = sim.Walk(r.value, 2*s.random.Float64()-1)
+		} else {
+			r.value = sim.At(elapsed)
+		}
+		s.store(slave, r)
+	}
+	return slave, nil
+}
+
+// hold stops generators of the registers within the written range
+func (s *Simulator) hold(slave *simSlave, table model.RegType, address, quantity uint16) {
+	for _, r := range slave.registers {
+		if overlaps(r.register, table, address, quantity) {
+			r.written = true
+		}
+	}
+}
+
+// store puts register's value into slave's table; values the register's data type can not hold are skipped
+func (s *Simulator) store(slave *simSlave, r *simRegister) {
+	register := r.register
+	if register.IsBit() {
+		slave.bits[register.Type][register.Address] = r.value != 0
+		return
+	}
+	v, err := fromFloat(register, r.value)
+	if err != nil {
+		return
+	}
+	data, err := encode(register, v)
+	if err != nil {
+		return
+	}
+	for i := 0; i+1 < len(data); i += 2 {
+		slave.words[register.Type][register.Address+uint16(i/2)] = binary.BigEndian.Uint16(data[i:])
+	}
+}
+
+func overlaps(register *model.Register, table model.RegType, address, quantity uint16) bool {
+	return register.Type == table &&
+		int(register.Address) < int(address)+int(quantity) && int(address) < int(register.Address)+int(register.Size)
+}
+
+// SimClientHandler passes requests to the simulator; its frames are the slave id followed by the PDU,
+// requests to a slave the simulator does not have time out
+type SimClientHandler struct {
+	simulator *Simulator
+	handler   server.Handler
+}
+
+func NewSimClientHandler(simulator *Simulator) *SimClientHandler {
+	return &SimClientHandler{
+		simulator: simulator,
+		handler:   server.NewDataHandler(simulator),
+	}
+}
+
+func (h *SimClientHandler) Encode(slaveId uint8, pdu *modbus.ProtocolDataUnit) (adu []byte, err error) {
+	return append([]byte{slaveId, pdu.FunctionCode}, pdu.Data...), nil
+}
+func (h *SimClientHandler) Decode(adu []byte) (pdu *modbus.ProtocolDataUnit, err error) {
+	if len(adu) < 2 {
+		return nil, fmt.Errorf("sim: response of %d bytes is too short", len(adu))
+	}
+	return &modbus.ProtocolDataUnit{FunctionCode: adu[1], Data: adu[2:]}, nil
+}
+func (h *SimClientHandler) Verify(aduRequest []byte, aduResponse []byte) (err error) {
+	if aduRequest[0] != aduResponse[0] {
+		return fmt.Errorf("sim: response slave id '%v' does not match request '%v'", aduResponse[0], aduRequest[0])
+	}
+	return nil
+}
+func (h *SimClientHandler) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	pdu, err := h.Decode(aduRequest)
+	if err != nil {
+		return nil, err
+	}
+	response, err := h.handler.Handle(aduRequest[0], pdu)
+	if errors.Is(err, errNoSlave) {
+		return nil, fmt.Errorf("sim: slave %d: %w", aduRequest[0], os.ErrDeadlineExceeded)
+	}
+	if err != nil {
+		response = server.Exception(pdu.FunctionCode, err)
+	}
+	return h.Encode(aduRequest[0], response)
+}
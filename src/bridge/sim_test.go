@@ -0,0 +1,50 @@
+package bridge
+
+import (
+	"github.com/mvkvl/modbus"
+	"mbridge/model/modeltest"
+	"testing"
+)
+
+func TestSimulator(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "mode": "sim", "devices": [{"title": "d", "slave_id": 1, "registers": [
+		{"title": "temp", "type": "input", "address": 10, "data_type": "float32", "sim": {"value": 21.5}},
+		{"title": "level", "type": "input", "address": 20, "sim": {"generator": "random_walk", "min": 100, "max": 200}},
+		{"title": "setpoint", "type": "holding", "address": 0, "sim": {"generator": "sine", "period": "1ms"}},
+		{"title": "pump", "type": "coil", "address": 3, "sim": {"value": 1}}]}]}]}`)
+	client := modbus.NewClient(NewSimClientHandler(NewSimulator(&config.Channels[0])))
+
+	if results, err := client.ReadInputRegisters(1, 10, 2); err != nil || "\x41\xac\x00\x00" != string(results) {
+		t.Errorf("expected float32 21.5 words, got '% x' (%v)", results, err)
+	}
+	for i := 0; i < 10; i++ {
+		results, err := client.ReadInputRegisters(1, 20, 1)
+		if v := int(results[0])<<8 | int(results[1]); err != nil || v < 100 || v > 200 {
+			t.Errorf("expected random walk within range, got %d (%v)", v, err)
+		}
+	}
+	if results, err := client.ReadCoils(1, 0, 4); err != nil || "\x08" != string(results) {
+		t.Errorf("expected coil 3 on, got '% x' (%v)", results, err)
+	}
+
+	// written values persist, the generator stops
+	if _, err := client.WriteSingleRegister(1, 0, 225); err != nil {
+		t.Fatalf("%s", err)
+	}
+	for i := 0; i < 3; i++ {
+		if results, err := client.ReadHoldingRegisters(1, 0, 1); err != nil || "\x00\xe1" != string(results) {
+			t.Errorf("expected written value 225, got '% x' (%v)", results, err)
+		}
+	}
+	if _, err := client.WriteSingleCoil(1, 3, 0); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if results, err := client.ReadCoils(1, 3, 1); err != nil || "\x00" != string(results) {
+		t.Errorf("expected coil off, got '% x' (%v)", results, err)
+	}
+
+	// unknown slaves do not answer
+	if _, err := client.ReadHoldingRegisters(2, 0, 1); !IsUnreachable(err) {
+		t.Errorf("expected unknown slave to be unreachable, got '%v'", err)
+	}
+}
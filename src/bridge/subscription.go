@@ -0,0 +1,180 @@
+package bridge
+
+import (
+	"mbridge/model"
+	"reflect"
+	"sync"
+)
+
+const defaultSubscriptionBuffer = 256
+
+// Overflow is what a subscription does with a change arriving while its buffer is full
+type Overflow int
+
+const (
+	// OverflowDrop drops the arriving change
+	OverflowDrop Overflow = iota
+	// OverflowCoalesce merges changes of a metric waiting for delivery into one, keeping its oldest
+	// previous & newest current value; a change of a metric not waiting yet is dropped if the buffer is full
+	OverflowCoalesce
+)
+
+// Change is a value set in the cache along with the one it replaced, which is nil for a new metric
+type Change struct {
+	Previous *model.Metric
+	Current  *model.Metric
+}
+
+// Changed reports whether the raw value differs from the previous one
+func (c Change) Changed() bool {
+	return c.Previous == nil || !reflect.DeepEqual(c.Previous.RawValue, c.Current.RawValue)
+}
+
+// SubscribeOptions configures a subscription; the zero value subscribes to every value set,
+// buffering the default number of changes & dropping further ones
+type SubscribeOptions struct {
+	Buffer   int
+	Overflow Overflow
+	// Filter selects metrics to be delivered; it is called by the executor & must be quick
+	Filter func(metric *model.Metric) bool
+	// ChangesOnly skips values equal to the previous ones
+	ChangesOnly bool
+}
+
+// Subscription delivers changes of cached metrics in the order they are set; the executor never
+// waits for a subscriber, changes which do not fit the buffer are handled as of the overflow policy
+type Subscription interface {
+	Changes() <-chan Change
+	// Dropped returns the number of changes dropped because the buffer was full
+	Dropped() uint64
+	// Close stops the delivery & closes the changes channel
+	Close()
+}
+
+type subscription struct {
+	options SubscribeOptions
+	queue   []Change
+	// pending maps metric keys to their changes in the queue, when coalescing
+	pending map[string]int
+	head    int
+	dropped uint64
+	closed  bool
+	signal  chan struct{}
+	changes chan Change
+	done    chan struct{}
+	mutex   sync.Mutex
+}
+
+func newSubscription(options SubscribeOptions) *subscription {
+	if options.Buffer < 1 {
+		options.Buffer = defaultSubscriptionBuffer
+	}
+	s := &subscription{
+		options: options,
+		pending: make(map[string]int),
+		signal:  make(chan struct{}, 1),
+		changes: make(chan Change),
+		done:    make(chan struct{}),
+	}
+	go s.deliver()
+	return s
+}
+
+func (s *subscription) Changes() <-chan Change {
+	return s.changes
+}
+func (s *subscription) Dropped() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dropped
+}
+func (s *subscription) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+}
+func (s *subscription) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// offer queues the change for delivery; it never blocks
+func (s *subscription) offer(change Change) {
+	if nil != s.options.Filter && !s.options.Filter(change.Current) {
+		return
+	}
+	if s.options.ChangesOnly && !change.Changed() {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	if s.options.Overflow == OverflowCoalesce {
+		if i, ok := s.pending[change.Current.Key]; ok {
+			s.queue[i].Current = change.Current
+			return
+		}
+	}
+	if len(s.queue)-s.head >= s.options.Buffer {
+		s.dropped++
+		return
+	}
+	if s.options.Overflow == OverflowCoalesce {
+		s.pending[change.Current.Key] = len(s.queue)
+	}
+	s.queue = append(s.queue, change)
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the oldest queued change
+func (s *subscription) next() (Change, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.head == len(s.queue) {
+		return Change{}, false
+	}
+	change := s.queue[s.head]
+	s.queue[s.head] = Change{}
+	s.head++
+	if s.options.Overflow == OverflowCoalesce {
+		delete(s.pending, change.Current.Key)
+	}
+	// compact the queue once delivered changes make up its larger part
+	if s.head > len(s.queue)/2 {
+		s.queue = append(s.queue[:0], s.queue[s.head:]...)
+		for key := range s.pending {
+			s.pending[key] -= s.head
+		}
+		s.head = 0
+	}
+	return change, true
+}
+func (s *subscription) deliver() {
+	defer close(s.changes)
+	for {
+		change, ok := s.next()
+		if !ok {
+			select {
+			case <-s.signal:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case s.changes <- change:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package bridge
+
+import (
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"testing"
+	"time"
+)
+
+func metric(key string, value uint16) *model.Metric {
+	return &model.Metric{Key: key, RawValue: value, Timestamp: time.Now()}
+}
+
+func receive(t *testing.T, s Subscription) Change {
+	t.Helper()
+	select {
+	case change := <-s.Changes():
+		return change
+	case <-time.After(time.Second):
+		t.Fatal("expected a change")
+	}
+	return Change{}
+}
+
+func TestSubscriptionDrop(t *testing.T) {
+	cache := CreateMetricCache(time.Minute)
+	s := cache.Subscribe(SubscribeOptions{Buffer: 2})
+	defer s.Close()
+
+	// nobody reads the changes, setting values must not block though
+	done := make(chan struct{})
+	go func() {
+		for i := range 10 {
+			cache.Set("c:d:r", metric("c:d:r", uint16(i)))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected set not to wait for the subscriber")
+	}
+	// the delivery goroutine may hold one change taken from the buffer
+	first := receive(t, s)
+	if nil != first.Previous || first.Current.RawValue != uint16(0) {
+		t.Errorf("expected first change to be new value 0, got %+v", first)
+	}
+	second := receive(t, s)
+	if second.Previous.RawValue != uint16(0) || second.Current.RawValue != uint16(1) {
+		t.Errorf("expected change from 0 to 1, got %v to %v", second.Previous.RawValue, second.Current.RawValue)
+	}
+	if dropped := s.Dropped(); dropped < 7 || dropped > 8 {
+		t.Errorf("expected 7 or 8 dropped changes, got %d", dropped)
+	}
+}
+
+func TestSubscriptionCoalesce(t *testing.T) {
+	cache := CreateMetricCache(time.Minute)
+	s := cache.Subscribe(SubscribeOptions{Buffer: 2, Overflow: OverflowCoalesce})
+	defer s.Close()
+
+	cache.Set("c:d:a", metric("c:d:a", 1))
+	// wait for the delivery goroutine to take the change, so that the following ones stay in the buffer
+	time.Sleep(50 * time.Millisecond)
+	for i := 2; i <= 5; i++ {
+		cache.Set("c:d:a", metric("c:d:a", uint16(i)))
+		cache.Set("c:d:b", metric("c:d:b", uint16(i)))
+	}
+	cache.Set("c:d:c", metric("c:d:c", 1))
+
+	if change := receive(t, s); change.Current.RawValue != uint16(1) {
+		t.Errorf("expected the taken change first, got %v", change.Current.RawValue)
+	}
+	// waiting changes keep the oldest previous & the newest current value
+	a := receive(t, s)
+	if a.Current.Key != "c:d:a" || a.Previous.RawValue != uint16(1) || a.Current.RawValue != uint16(5) {
+		t.Errorf("expected c:d:a change from 1 to 5, got %s %v to %v", a.Current.Key, a.Previous.RawValue, a.Current.RawValue)
+	}
+	b := receive(t, s)
+	if b.Current.Key != "c:d:b" || nil != b.Previous || b.Current.RawValue != uint16(5) {
+		t.Errorf("expected new c:d:b value 5, got %+v", b)
+	}
+	// a metric not waiting yet does not fit the full buffer
+	if dropped := s.Dropped(); dropped != 1 {
+		t.Errorf("expected 1 dropped change, got %d", dropped)
+	}
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	cache := CreateMetricCache(time.Minute)
+	s := cache.Subscribe(SubscribeOptions{
+		ChangesOnly: true,
+		Filter:      func(m *model.Metric) bool { return m.Key != "c:d:skip" },
+	})
+	cache.Set("c:d:r", metric("c:d:r", 1))
+	cache.Set("c:d:skip", metric("c:d:skip", 1))
+	cache.Set("c:d:r", metric("c:d:r", 1))
+	cache.Set("c:d:r", metric("c:d:r", 2))
+
+	if change := receive(t, s); !change.Changed() || nil != change.Previous {
+		t.Errorf("expected new value, got %+v", change)
+	}
+	if change := receive(t, s); change.Current.Key != "c:d:r" || change.Current.RawValue != uint16(2) {
+		t.Errorf("expected c:d:r change to 2, got %s %v", change.Current.Key, change.Current.RawValue)
+	}
+
+	s.Close()
+	select {
+	case _, ok := <-s.Changes():
+		if ok {
+			t.Error("expected no change after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected changes channel to be closed")
+	}
+	// closed subscriptions are removed from the cache
+	cache.Set("c:d:r", metric("c:d:r", 3))
+	if n := len(cache.(*metricCacheImpl).subscriptions); n != 0 {
+		t.Errorf("expected closed subscription to be removed, got %d", n)
+	}
+}
+
+func TestBridgeSubscribe(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "mode": "sim", "devices": [{"title": "d", "slave_id": 1, "registers": [
+		{"title": "level", "type": "input", "poll_interval": "20ms", "sim": {"generator": "ramp", "max": 1000, "period": "1s"}},
+		{"title": "temp", "type": "input", "poll_interval": "20ms"}]}]}]}`)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	br := CreateBridge(config)
+	// subscriptions made before the start are attached to caches of its channels
+	s := br.Subscribe(SubscribeOptions{
+		ChangesOnly: true,
+		Filter:      func(m *model.Metric) bool { return m.Register == "level" },
+	})
+	defer s.Close()
+	br.Start()
+	defer br.Stop()
+
+	previous := receive(t, s)
+	if previous.Current.Key != "c:d:level" {
+		t.Fatalf("expected c:d:level change, got %s", previous.Current.Key)
+	}
+	change := receive(t, s)
+	if change.Previous != previous.Current || !change.Changed() {
+		t.Errorf("expected change to follow the previous one, got %v to %v", change.Previous.RawValue, change.Current.RawValue)
+	}
+}
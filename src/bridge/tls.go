@@ -0,0 +1,142 @@
+package bridge
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"github.com/mvkvl/modbus"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	tlsTimeout     = 10 * time.Second
+	tlsIdleTimeout = 60 * time.Second
+	// tlsPort is the IANA port of Modbus/TCP Security, used when connection omits the port
+	tlsPort = "802"
+	// MBAP header without unit id, unit id + function code + up to 252 bytes of data
+	mbapHeaderSize = 6
+	mbapMaxLength  = 254
+)
+
+// RoleOID is the certificate extension carrying the role of a Modbus/TCP Security client
+var RoleOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 50316, 802, 1}
+
+// CertificateRole extracts the Modbus role from the certificate; false is returned if it has none
+func CertificateRole(cert *x509.Certificate) (string, bool, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(RoleOID) {
+			continue
+		}
+		var role string
+		if _, err := asn1.UnmarshalWithParams(ext.Value, &role, "utf8"); err != nil {
+			return "", false, fmt.Errorf("invalid role extension: %w", err)
+		}
+		return role, true, nil
+	}
+	return "", false, nil
+}
+
+// TLSClientHandler talks Modbus/TCP Security: Modbus TCP frames over a mutually authenticated TLS session
+type TLSClientHandler struct {
+	// Modbus TCP framing, incl. transaction ids
+	modbus.Packager
+	// Connect string
+	Address string
+	// Connect & read timeout
+	Timeout time.Duration
+	// Idle timeout to close the session
+	IdleTimeout time.Duration
+	// Role is the role from the client certificate, granting the client its access rights on the server
+	Role string
+
+	config *tls.Config
+	err    error
+	idleConn
+}
+
+// NewTLSClientHandler creates handler for the given client configuration; a configuration
+// error is reported by every request, as the handler is created when the bridge starts
+func NewTLSClientHandler(address string, config *tls.Config, err error) *TLSClientHandler {
+	if _, _, e := net.SplitHostPort(address); e != nil {
+		address = net.JoinHostPort(address, tlsPort)
+	}
+	h := &TLSClientHandler{
+		Packager:    modbus.NewTCPClientHandler(address),
+		Address:     address,
+		Timeout:     tlsTimeout,
+		IdleTimeout: tlsIdleTimeout,
+		config:      config,
+		err:         err,
+	}
+	h.dial = func() (net.Conn, error) {
+		dialer := &net.Dialer{Timeout: h.Timeout}
+		return tls.DialWithDialer(dialer, "tcp", h.Address, h.config)
+	}
+	if err == nil && len(config.Certificates) > 0 {
+		cert, e := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+		if e != nil {
+			h.err = fmt.Errorf("invalid client certificate: %w", e)
+		} else {
+			h.Role, _, h.err = CertificateRole(cert)
+		}
+	}
+	return h
+}
+
+// Err returns the configuration error requests fail with, if any
+func (mb *TLSClientHandler) Err() error {
+	return mb.err
+}
+
+func (mb *TLSClientHandler) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if err = mb.connect(); err != nil {
+		return
+	}
+	if err = mb.use(mb.Timeout, mb.IdleTimeout); err != nil {
+		return
+	}
+	if _, err = mb.conn.Write(aduRequest); err != nil {
+		mb.close()
+		return
+	}
+	var data [mbapHeaderSize + mbapMaxLength]byte
+	if _, err = io.ReadFull(mb.conn, data[:mbapHeaderSize]); err != nil {
+		mb.close()
+		return
+	}
+	length := int(binary.BigEndian.Uint16(data[4:]))
+	if length < 2 || length > mbapMaxLength {
+		mb.close()
+		return nil, fmt.Errorf("modbus: invalid length in response header '%v'", length)
+	}
+	if _, err = io.ReadFull(mb.conn, data[mbapHeaderSize:mbapHeaderSize+length]); err != nil {
+		mb.close()
+		return
+	}
+	return append([]byte(nil), data[:mbapHeaderSize+length]...), nil
+}
+func (mb *TLSClientHandler) Connect() error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.connect()
+}
+func (mb *TLSClientHandler) Close() error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.close()
+}
+
+// connect fails with the configuration error, if any, before dialing
+func (mb *TLSClientHandler) connect() error {
+	if mb.err != nil {
+		return mb.err
+	}
+	return mb.idleConn.connect()
+}
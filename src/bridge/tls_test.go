@@ -0,0 +1,188 @@
+package bridge
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"github.com/mvkvl/modbus"
+	"io"
+	"math/big"
+	"mbridge/model"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issueCert creates a certificate signed by the parent one, or a self-signed CA for nil parent
+func issueCert(t *testing.T, parent *testCert, name string, role string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if role != "" {
+		value, _ := asn1.MarshalWithParams(role, "utf8")
+		template.ExtraExtensions = []pkix.Extension{{Id: RoleOID, Value: value}}
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+func writePEM(t *testing.T, dir string, name string, c *testCert) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	keyDer, _ := x509.MarshalECPrivateKey(c.key)
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("%s", err)
+	}
+	return certFile, keyFile
+}
+
+// serveTLS answers read holding registers requests of clients with 'operator' role
+// with register address as value, denying other roles with illegal function exception
+func serveTLS(t *testing.T, ca, server *testCert) string {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.der}, PrivateKey: server.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTLSConn(conn.(*tls.Conn))
+		}
+	}()
+	return listener.Addr().String()
+}
+func serveTLSConn(conn *tls.Conn) {
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		return
+	}
+	role, _, _ := CertificateRole(conn.ConnectionState().PeerCertificates[0])
+	request := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		var response []byte
+		if role != "operator" {
+			response = append(request[:4:4], 0, 3, request[6], request[7]|0x80, modbus.ExceptionCodeIllegalFunction)
+		} else {
+			address, quantity := binary.BigEndian.Uint16(request[8:]), binary.BigEndian.Uint16(request[10:])
+			response = append(request[:4:4], 0, byte(3+2*quantity), request[6], request[7], byte(2*quantity))
+			for i := range quantity {
+				response = binary.BigEndian.AppendUint16(response, address+i)
+			}
+		}
+		conn.Write(response)
+	}
+}
+func TestTLSClientHandler(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, nil, "ca", "")
+	address := serveTLS(t, ca, issueCert(t, ca, "plc", ""))
+	caFile, _ := writePEM(t, dir, "ca", ca)
+
+	for _, test := range []struct {
+		role string
+		err  bool
+	}{{"operator", false}, {"viewer", true}} {
+		certFile, keyFile := writePEM(t, dir, test.role, issueCert(t, ca, "bridge", test.role))
+		channel := &model.Channel{Mode: model.TLS, Connection: address,
+			TLS: &model.TLSSettings{Cert: certFile, Key: keyFile, CA: caFile, ServerName: "plc"}}
+		handler := createModbusHandlerFactory(channel, channel.Connection).(*TLSClientHandler)
+		if test.role != handler.Role {
+			t.Errorf("expected role '%s', got '%s' instead", test.role, handler.Role)
+		}
+		results, err := modbus.NewClient(handler).ReadHoldingRegisters(1, 10, 2)
+		handler.Close()
+		if test.err {
+			var modbusError *modbus.ModbusError
+			if !errors.As(err, &modbusError) || modbus.ExceptionCodeIllegalFunction != modbusError.ExceptionCode {
+				t.Errorf("expected role '%s' to be denied, got '%v' instead", test.role, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if expected := []byte{0, 10, 0, 11}; string(expected) != string(results) {
+			t.Errorf("expected '% x', got '% x' instead", expected, results)
+		}
+	}
+}
+func TestTLSClientHandlerUntrustedServer(t *testing.T) {
+	dir := t.TempDir()
+	ca, other := issueCert(t, nil, "ca", ""), issueCert(t, nil, "other", "")
+	address := serveTLS(t, ca, issueCert(t, other, "plc", ""))
+	caFile, _ := writePEM(t, dir, "ca", ca)
+	certFile, keyFile := writePEM(t, dir, "client", issueCert(t, ca, "bridge", "operator"))
+
+	channel := &model.Channel{Mode: model.TLS, Connection: address,
+		TLS: &model.TLSSettings{Cert: certFile, Key: keyFile, CA: caFile, ServerName: "plc"}}
+	handler := createModbusHandlerFactory(channel, channel.Connection).(*TLSClientHandler)
+	defer handler.Close()
+	if _, err := modbus.NewClient(handler).ReadHoldingRegisters(1, 10, 2); err == nil {
+		t.Error("expected server with untrusted certificate to be rejected")
+	}
+}
+func TestTLSDefaultPort(t *testing.T) {
+	if h := NewTLSClientHandler("plc.local", &tls.Config{}, nil); "plc.local:802" != h.Address {
+		t.Errorf("expected default port 802, got '%s' instead", h.Address)
+	}
+}
+func TestTLSClientHandlerInvalidCertificate(t *testing.T) {
+	config := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{[]byte("not a certificate")}}}}
+	handler := NewTLSClientHandler("127.0.0.1:1", config, nil)
+	if nil == handler.Err() {
+		t.Fatal("expected certificate which can not be parsed to be reported")
+	}
+	if _, err := handler.Send([]byte{0}); !errors.Is(err, handler.Err()) {
+		t.Errorf("expected requests to fail with '%v', got '%v' instead", handler.Err(), err)
+	}
+}
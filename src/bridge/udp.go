@@ -0,0 +1,86 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mvkvl/modbus"
+	"net"
+	"time"
+)
+
+const (
+	udpTimeout     = 10 * time.Second
+	udpIdleTimeout = 60 * time.Second
+	// MBAP header (7 bytes) + function code + up to 252 bytes of data
+	udpMinSize = 8
+	udpMaxSize = 260
+)
+
+// UDPClientHandler talks Modbus over UDP: requests are framed as Modbus TCP (with MBAP
+// header), each one sent as a single datagram & answered with a single datagram
+type UDPClientHandler struct {
+	// Modbus TCP framing, incl. transaction ids
+	modbus.Packager
+	// Connect string
+	Address string
+	// Read timeout
+	Timeout time.Duration
+	// Idle timeout to close the socket
+	IdleTimeout time.Duration
+
+	idleConn
+}
+
+func NewUDPClientHandler(address string) *UDPClientHandler {
+	h := &UDPClientHandler{
+		Packager:    modbus.NewTCPClientHandler(address),
+		Address:     address,
+		Timeout:     udpTimeout,
+		IdleTimeout: udpIdleTimeout,
+	}
+	h.dial = func() (net.Conn, error) {
+		return net.Dial("udp", h.Address)
+	}
+	return h
+}
+
+// Send writes the request datagram & waits for the answer to it; late answers
+// to earlier requests, which timed out, are recognized by transaction id and dropped
+func (mb *UDPClientHandler) Send(aduRequest []byte) (aduResponse []byte, err error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if err = mb.connect(); err != nil {
+		return
+	}
+	if err = mb.use(mb.Timeout, mb.IdleTimeout); err != nil {
+		return
+	}
+	if _, err = mb.conn.Write(aduRequest); err != nil {
+		return
+	}
+	transactionId := binary.BigEndian.Uint16(aduRequest)
+	var data [udpMaxSize + 1]byte
+	for {
+		var n int
+		if n, err = mb.conn.Read(data[:]); err != nil {
+			return
+		}
+		if n < udpMinSize || n > udpMaxSize {
+			return nil, fmt.Errorf("modbus: invalid response datagram length '%v'", n)
+		}
+		if binary.BigEndian.Uint16(data[:]) == transactionId {
+			return append([]byte(nil), data[:n]...), nil
+		}
+	}
+}
+func (mb *UDPClientHandler) Connect() error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.connect()
+}
+func (mb *UDPClientHandler) Close() error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.close()
+}
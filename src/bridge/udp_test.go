@@ -0,0 +1,74 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveUDP answers read holding registers requests with register address as value,
+// preceding every answer with a stale one, which the client has to drop
+func serveUDP(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buff := make([]byte, 260)
+		for {
+			n, addr, err := conn.ReadFrom(buff)
+			if err != nil {
+				return
+			}
+			request := buff[:n]
+			address, quantity := binary.BigEndian.Uint16(request[8:]), binary.BigEndian.Uint16(request[10:])
+			response := make([]byte, 9+2*quantity)
+			copy(response, request[:4])
+			binary.BigEndian.PutUint16(response[4:], 3+2*quantity)
+			response[6], response[7], response[8] = request[6], request[7], byte(2*quantity)
+			for i := range quantity {
+				binary.BigEndian.PutUint16(response[9+2*i:], address+i)
+			}
+			stale := append([]byte(nil), response...)
+			binary.BigEndian.PutUint16(stale, binary.BigEndian.Uint16(request)-1)
+			conn.WriteTo(stale, addr)
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+func TestUDPClientHandler(t *testing.T) {
+	channel := &model.Channel{Mode: model.UDP, Connection: serveUDP(t)}
+	handler := createModbusHandlerFactory(channel, channel.Connection)
+	client := modbus.NewClient(handler)
+	defer handler.(*UDPClientHandler).Close()
+
+	for range 2 {
+		results, err := client.ReadHoldingRegisters(1, 10, 2)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if expected := []byte{0, 10, 0, 11}; string(expected) != string(results) {
+			t.Errorf("expected '% x', got '% x' instead", expected, results)
+		}
+	}
+}
+func TestUDPClientHandlerTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer conn.Close()
+	handler := NewUDPClientHandler(conn.LocalAddr().String())
+	handler.Timeout = 50 * time.Millisecond
+	client := modbus.NewClient(handler)
+	defer handler.Close()
+
+	if _, err := client.ReadHoldingRegisters(1, 0, 1); !IsDeviceTimeout(err) {
+		t.Errorf("expected timeout, got '%v' instead", err)
+	}
+}
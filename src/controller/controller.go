@@ -2,25 +2,32 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/xhit/go-str2duration/v2"
 	"io"
 	"mbridge/bridge"
 	"mbridge/model"
 	"mbridge/util"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type ModbusBridgeController interface {
 	Start(w http.ResponseWriter, r *http.Request)
 	Stop(w http.ResponseWriter, r *http.Request)
 	Registers(w http.ResponseWriter, r *http.Request)
+	Devices(w http.ResponseWriter, r *http.Request)
+	Channels(w http.ResponseWriter, r *http.Request)
 	Metrics(w http.ResponseWriter, r *http.Request)
 	PrometheusMetrics(w http.ResponseWriter, r *http.Request)
 	Get(w http.ResponseWriter, r *http.Request)
 	Write(w http.ResponseWriter, r *http.Request)
 	Flush(w http.ResponseWriter, r *http.Request)
+	Stream(w http.ResponseWriter, r *http.Request)
 }
 
 type modbusBridgeControllerImpl struct {
@@ -34,16 +41,34 @@ func NewBridgeController(bridge bridge.Bridge) ModbusBridgeController {
 }
 
 func (c *modbusBridgeControllerImpl) Registers(w http.ResponseWriter, r *http.Request) {
-	header := "%-30s %-8s %-5s %-5s %-7s %-7s"
-	out := fmt.Sprintf(header, "reference", "type", "mode", "size", "addr", "factor")
+	header := "%-30s %-8s %-5s %-5s %-7s %-7s %-8s %-5s"
+	out := fmt.Sprintf(header, "reference", "type", "mode", "size", "addr", "factor", "data", "order")
 	w.Write([]byte(fmt.Sprintf("%s\n", out)))
 
-	template := "%-30s %-8s %-5s %-5d %-7d %-5.2f"
+	template := "%-30s %-8s %-5s %-5d %-7d %-7.2f %-8s %-5s"
 	for _, r := range c.bridge.Regs() {
-		out = fmt.Sprintf(template, model.MetricKey(r), r.Type, r.Mode, r.Size, r.Address, r.Factor)
+		out = fmt.Sprintf(template, model.MetricKey(r), r.Type, r.Mode, r.Size, r.Address, r.Factor, r.DataType, r.ByteOrder)
 		w.Write([]byte(fmt.Sprintf("%s\n", out)))
+		for _, b := range r.Bits {
+			out = fmt.Sprintf(template, model.BitMetricKey(r, &b), "bits", r.Mode, r.Size, r.Address, 1.0, fmt.Sprintf("%#x", b.Mask), "")
+			w.Write([]byte(fmt.Sprintf("%s\n", out)))
+		}
 	}
 }
+
+// Devices lists devices' online/offline state as JSON
+func (c *modbusBridgeControllerImpl) Devices(w http.ResponseWriter, r *http.Request) {
+	buff, _ := json.Marshal(c.bridge.Devices())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buff)
+}
+
+// Channels lists channels' active connections as JSON
+func (c *modbusBridgeControllerImpl) Channels(w http.ResponseWriter, r *http.Request) {
+	buff, _ := json.Marshal(c.bridge.Channels())
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buff)
+}
 func (c *modbusBridgeControllerImpl) Metrics(w http.ResponseWriter, r *http.Request) {
 	for _, m := range c.bridge.List() {
 		w.Write([]byte(fmt.Sprintf("%s\n", m)))
@@ -52,16 +77,47 @@ func (c *modbusBridgeControllerImpl) Metrics(w http.ResponseWriter, r *http.Requ
 func (c *modbusBridgeControllerImpl) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
 	template := "modbus_metric_%s{channel=\"%s\",device=\"%s\",alias=\"%s\",register=\"%s\"} %s"
 	for _, m := range c.bridge.List() {
-		raw := fmt.Sprintf(fmt.Sprintf(template, "raw", m.Channel, m.Device, m.Alias, m.Register, "%d"), m.RawValue)
+		if m.IsText() {
+			text := fmt.Sprintf("modbus_metric_text{channel=\"%s\",device=\"%s\",alias=\"%s\",register=\"%s\",text=%q} 1",
+				m.Channel, m.Device, m.Alias, m.Register, m.Text)
+			w.Write([]byte(fmt.Sprintf("%s\n", text)))
+			continue
+		}
+		raw := fmt.Sprintf(fmt.Sprintf(template, "raw", m.Channel, m.Device, m.Alias, m.Register, "%v"), m.RawValue)
 		w.Write([]byte(fmt.Sprintf("%s\n", raw)))
 		val := fmt.Sprintf(fmt.Sprintf(template, "value", m.Channel, m.Device, m.Alias, m.Register, "%f"), m.Value)
 		w.Write([]byte(fmt.Sprintf("%s\n", val)))
 		ts := fmt.Sprintf(fmt.Sprintf(template, "timestamp", m.Channel, m.Device, m.Alias, m.Register, "%d"), m.Timestamp.Unix())
 		w.Write([]byte(fmt.Sprintf("%s\n", ts)))
 	}
+	for _, d := range c.bridge.Devices() {
+		online := 0
+		if d.Online {
+			online = 1
+		}
+		state := fmt.Sprintf("modbus_device_online{channel=\"%s\",device=\"%s\",alias=\"%s\"} %d", d.Channel, d.Device, d.Alias, online)
+		w.Write([]byte(fmt.Sprintf("%s\n", state)))
+	}
 }
+
+// Get returns cached metric value; with 'fresh=true' or 'max_age=<duration>' query
+// parameters a value older than allowed is read from the device on demand
 func (c *modbusBridgeControllerImpl) Get(w http.ResponseWriter, r *http.Request) {
-	result, err := c.bridge.Get(getMetricKey(r))
+	maxAge, fresh, err := parseMaxAge(r)
+	if nil != err {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var result *model.Metric
+	if fresh {
+		result, err = c.bridge.Read(getMetricKey(r), maxAge)
+		if nil != err {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+	} else {
+		result, err = c.bridge.Get(getMetricKey(r))
+	}
 	if nil != err {
 		w.WriteHeader(404)
 		w.Write([]byte(fmt.Sprintf("{\"error\": \"%s\"}", err)))
@@ -80,36 +136,30 @@ func (c *modbusBridgeControllerImpl) Write(w http.ResponseWriter, r *http.Reques
 	b, e := io.ReadAll(r.Body)
 	defer r.Body.Close()
 	if nil != e {
-		w.Write([]byte(fmt.Sprintf("Error: %s", e)))
+		writeError(w, http.StatusBadRequest, e)
 		return
 	}
-	bodyStr := string(b)
-
-	ok := false
-	v, e := strconv.ParseUint(bodyStr, 10, 64)
+	v, e := parseWriteRequest(string(b))
 	if nil != e {
-		bodyStr, e = util.HexaNumberToInteger(bodyStr)
-		if nil != e {
-			w.Write([]byte(fmt.Sprintf("Error: %s", e)))
-			return
-		} else {
-			v, e = strconv.ParseUint(bodyStr, 16, 64)
-			if nil != e {
-				w.Write([]byte(fmt.Sprintf("Error: %s", e)))
-				return
-			} else {
-				ok = true
-			}
-		}
-	} else {
-		ok = true
+		writeError(w, http.StatusBadRequest, e)
+		return
 	}
-	if ok {
-		e = c.bridge.Set(getMetricKey(r), uint16(v))
-		if nil != e {
-			w.Write([]byte(fmt.Sprintf("Error: %s", e)))
-			return
-		}
+	key := getMetricKey(r)
+	switch {
+	case nil != v.text:
+		e = c.bridge.SetText(key, *v.text)
+	case v.multiple && v.raw:
+		e = c.bridge.SetRawMultiple(key, v.values)
+	case v.multiple:
+		e = c.bridge.SetMultiple(key, v.values)
+	case v.raw:
+		e = c.bridge.SetRaw(key, v.values[0])
+	default:
+		e = c.bridge.Set(key, v.values[0])
+	}
+	if nil != e {
+		writeError(w, errorStatus(e), e)
+		return
 	}
 	w.Write([]byte("ok"))
 }
@@ -126,6 +176,132 @@ func (c *modbusBridgeControllerImpl) Stop(w http.ResponseWriter, r *http.Request
 	w.Write([]byte(fmt.Sprintf("ok\n")))
 }
 
+// errorStatus maps bridge errors to HTTP status codes: unknown references are 404, device
+// exceptions and failures 502, timeouts 504, busy channels 503, anything else is considered a bad request
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, bridge.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, bridge.ErrQueueFull) || errors.Is(err, bridge.ErrStopped):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, bridge.ErrTimeout) || bridge.IsDeviceTimeout(err):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, bridge.ErrDevice):
+		return http.StatusBadGateway
+	default:
+		return http.StatusBadRequest
+	}
+}
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := map[string]any{"error": err.Error()}
+	if code, ok := bridge.ExceptionCode(err); ok {
+		body["exception_code"] = code
+	}
+	buff, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(buff)
+}
+
+// parseMaxAge reads 'fresh' and 'max_age' query parameters; returns whether an on-demand read is allowed at all
+func parseMaxAge(r *http.Request) (time.Duration, bool, error) {
+	query := r.URL.Query()
+	if v := query.Get("max_age"); v != "" {
+		maxAge, err := str2duration.ParseDuration(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid max_age '%s'", v)
+		}
+		return maxAge, true, nil
+	}
+	if v := query.Get("fresh"); v != "" {
+		fresh, err := strconv.ParseBool(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid fresh '%s'", v)
+		}
+		return 0, fresh, nil
+	}
+	return 0, false, nil
+}
+
 func getMetricKey(r *http.Request) string {
 	return mux.Vars(r)["metric"]
 }
+
+type writeRequest struct {
+	Value json.RawMessage `json:"value"`
+	Raw   json.RawMessage `json:"raw"`
+}
+
+// writeValue is a parsed write request: a single value, a block of values or a text
+type writeValue struct {
+	raw      bool
+	multiple bool
+	values   []float64
+	text     *string
+}
+
+// parseWriteRequest accepts {"value": ...} or {"raw": ...} with a number, an array of numbers or a string,
+// a plain decimal number or array (engineering values), a JSON string (text) or a plain integer or
+// 0x-prefixed hexadecimal number (raw value)
+func parseWriteRequest(body string) (*writeValue, error) {
+	body = strings.TrimSpace(body)
+	if strings.HasPrefix(body, "{") {
+		var request writeRequest
+		if e := json.Unmarshal([]byte(body), &request); nil != e {
+			return nil, e
+		}
+		if nil != request.Value && nil != request.Raw {
+			return nil, errors.New("either value or raw must be set, not both")
+		}
+		if nil != request.Value {
+			return parseWriteValue(request.Value, false)
+		}
+		if nil != request.Raw {
+			return parseWriteValue(request.Raw, true)
+		}
+		return nil, errors.New("either value or raw must be set")
+	}
+	if strings.HasPrefix(body, "[") || strings.HasPrefix(body, "\"") {
+		return parseWriteValue([]byte(body), false)
+	}
+	if hex, e := util.HexaNumberToInteger(body); nil == e {
+		v, e := strconv.ParseUint(hex, 16, 64)
+		if nil != e {
+			return nil, e
+		}
+		return &writeValue{raw: true, values: []float64{float64(v)}}, nil
+	}
+	// a plain integer is a raw value, as it has always been; engineering values need a decimal point
+	if v, e := strconv.ParseInt(body, 10, 64); nil == e {
+		return &writeValue{raw: true, values: []float64{float64(v)}}, nil
+	}
+	v, e := strconv.ParseFloat(body, 64)
+	if nil != e {
+		return nil, e
+	}
+	return &writeValue{values: []float64{v}}, nil
+}
+func parseWriteValue(data json.RawMessage, raw bool) (*writeValue, error) {
+	var value any
+	if e := json.Unmarshal(data, &value); nil != e {
+		return nil, e
+	}
+	switch v := value.(type) {
+	case float64:
+		return &writeValue{raw: raw, values: []float64{v}}, nil
+	case string:
+		return &writeValue{raw: raw, text: &v}, nil
+	case []any:
+		result := &writeValue{raw: raw, multiple: true, values: make([]float64, len(v))}
+		for i, item := range v {
+			f, ok := item.(float64)
+			if !ok {
+				return nil, fmt.Errorf("array element %d is not a number: %v", i, item)
+			}
+			result.values[i] = f
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported value: %s", string(data))
+	}
+}
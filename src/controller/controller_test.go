@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"mbridge/bridge"
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWriteRequest(t *testing.T) {
+	tests := []struct {
+		body     string
+		values   []float64
+		raw      bool
+		multiple bool
+	}{
+		{`{"value": 22.5}`, []float64{22.5}, false, false},
+		{`{"raw": 225}`, []float64{225}, true, false},
+		{`22.5`, []float64{22.5}, false, false},
+		{` 1.0 `, []float64{1}, false, false},
+		// plain integers are raw values, as they were before engineering values
+		{`225`, []float64{225}, true, false},
+		{` 1 `, []float64{1}, true, false},
+		{`0xFF00`, []float64{0xFF00}, true, false},
+		{`[1, 0, 1]`, []float64{1, 0, 1}, false, true},
+		{`{"raw": [225, 226]}`, []float64{225, 226}, true, true},
+	}
+	for _, test := range tests {
+		v, err := parseWriteRequest(test.body)
+		if err != nil {
+			t.Fatalf("%s: %s", test.body, err)
+		}
+		if !slices.Equal(test.values, v.values) || test.raw != v.raw || test.multiple != v.multiple {
+			t.Errorf("%s: expected %v (raw: %t, multiple: %t), got %v (raw: %t, multiple: %t) instead",
+				test.body, test.values, test.raw, test.multiple, v.values, v.raw, v.multiple)
+		}
+	}
+	for _, body := range []string{`{}`, `{"value": 1, "raw": 1}`, `abc`, `0xZZ`, `[1, "a"]`} {
+		if _, err := parseWriteRequest(body); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+}
+func TestParseTextWriteRequest(t *testing.T) {
+	for _, body := range []string{`"SN-0001"`, `{"value": "SN-0001"}`} {
+		v, err := parseWriteRequest(body)
+		if err != nil {
+			t.Fatalf("%s: %s", body, err)
+		}
+		if nil == v.text || "SN-0001" != *v.text {
+			t.Errorf("%s: expected text 'SN-0001', got %v instead", body, v.text)
+		}
+	}
+}
+
+// simulatedBridge starts the bridge with a simulated channel 'c' of device 'd'
+func simulatedBridge(t *testing.T) bridge.Bridge {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "mode": "sim", "cycle_pause": "10ms", "devices": [{"title": "d", "slave_id": 1, "registers": [
+		{"title": "temp", "type": "input", "data_type": "float32", "sim": {"value": 21.5}},
+		{"title": "setpoint", "type": "holding", "address": 10, "factor": 0.5, "sim": {"value": 40}},
+		{"title": "level", "type": "input", "address": 20, "poll_interval": "20ms", "sim": {"generator": "ramp", "max": 1000, "period": "1s"}}]}]}]}`)
+	br := bridge.CreateBridge(config)
+	br.Start()
+	t.Cleanup(br.Stop)
+	return br
+}
+
+// TestSimulatedChannel runs the bridge against a simulated channel through the HTTP API
+func TestSimulatedChannel(t *testing.T) {
+	controller := NewBridgeController(simulatedBridge(t))
+	r := mux.NewRouter()
+	r.HandleFunc("/metric/{metric}", controller.Get).Methods("GET")
+	r.HandleFunc("/metric/{metric}", controller.Write).Methods("POST")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	get := func(query string) (*model.Metric, int) {
+		response, err := http.Get(srv.URL + "/metric/" + query)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		defer response.Body.Close()
+		var metric model.Metric
+		_ = json.NewDecoder(response.Body).Decode(&metric)
+		return &metric, response.StatusCode
+	}
+
+	// polled value appears in the cache
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if m, status := get("c:d:temp"); http.StatusOK == status {
+			if 21.5 != m.Value {
+				t.Errorf("expected polled value 21.5, got %v instead", m.Value)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no value polled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m, status := get("c:d:setpoint?fresh=true"); http.StatusOK != status || 20 != m.Value {
+		t.Errorf("expected seeded value 20, got %v (%d)", m.Value, status)
+	}
+	response, err := http.Post(srv.URL+"/metric/c:d:setpoint", "application/json", strings.NewReader(`22.5`))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	response.Body.Close()
+	if http.StatusOK != response.StatusCode {
+		t.Fatalf("expected write to succeed, got %d", response.StatusCode)
+	}
+	if m, status := get("c:d:setpoint?fresh=true"); http.StatusOK != status || 22.5 != m.Value {
+		t.Errorf("expected written value 22.5, got %v (%d)", m.Value, status)
+	}
+
+	// a plain integer is written as raw value, the factor is not applied to it
+	response, err = http.Post(srv.URL+"/metric/c:d:setpoint", "application/json", strings.NewReader(`50`))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	response.Body.Close()
+	if m, status := get("c:d:setpoint?fresh=true"); http.StatusOK != status || float64(50) != m.RawValue || 25 != m.Value {
+		t.Errorf("expected raw value 50 (25), got %v (%v, %d)", m.RawValue, m.Value, status)
+	}
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xhit/go-str2duration/v2"
+	"mbridge/bridge"
+	"mbridge/model"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultHeartbeat = 15 * time.Second
+	// streamBuffer is the number of metrics waiting to be sent to a client, further ones are dropped
+	streamBuffer = 256
+)
+
+// streamFilter selects metrics by glob patterns (as of path.Match) of channel, device (title or alias)
+// and register; an empty pattern matches anything
+type streamFilter struct {
+	channel  string
+	device   string
+	register string
+}
+
+func parseStreamFilter(r *http.Request) (streamFilter, error) {
+	query := r.URL.Query()
+	filter := streamFilter{query.Get("channel"), query.Get("device"), query.Get("register")}
+	for _, pattern := range []string{filter.channel, filter.device, filter.register} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return filter, fmt.Errorf("invalid pattern '%s'", pattern)
+		}
+	}
+	return filter, nil
+}
+func (f streamFilter) matches(metric *model.Metric) bool {
+	return match(f.channel, metric.Channel) &&
+		(match(f.device, metric.Device) || match(f.device, metric.Alias)) &&
+		match(f.register, metric.Register)
+}
+func match(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// Stream pushes new & changed metric values as server-sent 'metric' events, filtered by 'channel',
+// 'device' & 'register' glob patterns; a 'heartbeat' event is sent every 'heartbeat' interval (15s
+// by default) & 'snapshot=true' sends cached values first
+func (c *modbusBridgeControllerImpl) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	filter, err := parseStreamFilter(r)
+	if nil != err {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	heartbeat := defaultHeartbeat
+	if v := r.URL.Query().Get("heartbeat"); v != "" {
+		if heartbeat, err = str2duration.ParseDuration(v); err != nil || heartbeat <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid heartbeat '%s'", v))
+			return
+		}
+	}
+	snapshot, _ := strconv.ParseBool(r.URL.Query().Get("snapshot"))
+
+	// a slow client misses values rather than getting coalesced ones, so that short pulses are not lost
+	subscription := c.bridge.Subscribe(bridge.SubscribeOptions{
+		Buffer:      streamBuffer,
+		Overflow:    bridge.OverflowDrop,
+		Filter:      filter.matches,
+		ChangesOnly: true,
+	})
+	defer subscription.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if snapshot {
+		for _, m := range c.bridge.List() {
+			if filter.matches(m) {
+				writeEvent(w, "metric", m)
+			}
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case change, ok := <-subscription.Changes():
+			if !ok {
+				return
+			}
+			writeEvent(w, "metric", change.Current)
+		case now := <-ticker.C:
+			writeEvent(w, "heartbeat", map[string]time.Time{"timestamp": now})
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+func writeEvent(w http.ResponseWriter, event string, data any) {
+	buff, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, buff)
+}
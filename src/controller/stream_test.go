@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"mbridge/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	controller := NewBridgeController(simulatedBridge(t))
+	r := mux.NewRouter()
+	r.HandleFunc("/stream", controller.Stream).Methods("GET")
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL + "/stream?register=l*&heartbeat=50ms")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer response.Body.Close()
+	if "text/event-stream" != response.Header.Get("Content-Type") {
+		t.Fatalf("expected event stream, got '%s'", response.Header.Get("Content-Type"))
+	}
+	events := make(chan [2]string)
+	go func() {
+		var event string
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				events <- [2]string{event, strings.TrimPrefix(line, "data: ")}
+			}
+		}
+		close(events)
+	}()
+
+	// the ramp changes at every poll, so the filtered register keeps coming
+	metrics, heartbeats := 0, 0
+	deadline := time.After(5 * time.Second)
+	for metrics < 3 || heartbeats < 1 {
+		select {
+		case event := <-events:
+			switch event[0] {
+			case "metric":
+				var metric model.Metric
+				if err := json.Unmarshal([]byte(event[1]), &metric); err != nil {
+					t.Fatalf("%s", err)
+				}
+				if "c:d:level" != metric.Key {
+					t.Fatalf("expected only filtered register, got %s", metric.Key)
+				}
+				metrics++
+			case "heartbeat":
+				heartbeats++
+			}
+		case <-deadline:
+			t.Fatalf("expected metrics & heartbeat, got %d metrics & %d heartbeats", metrics, heartbeats)
+		}
+	}
+}
+func TestStreamFilter(t *testing.T) {
+	metric := &model.Metric{Channel: "c", Device: "d", Alias: "boiler", Register: "temp"}
+	tests := []struct {
+		filter  streamFilter
+		matches bool
+	}{
+		{streamFilter{}, true},
+		{streamFilter{channel: "c", device: "boiler", register: "t*"}, true},
+		{streamFilter{device: "d"}, true},
+		{streamFilter{channel: "x"}, false},
+		{streamFilter{register: "temp?"}, false},
+	}
+	for _, test := range tests {
+		if test.matches != test.filter.matches(metric) {
+			t.Errorf("%+v: expected match '%t'", test.filter, test.matches)
+		}
+	}
+	request := httptest.NewRequest("GET", "/stream?register=[", nil)
+	if _, err := parseStreamFilter(request); err == nil {
+		t.Error("expected invalid pattern error")
+	}
+}
@@ -3,17 +3,24 @@ module mbridge
 go 1.22.1
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/expr-lang/expr v1.16.9
+	github.com/goburrow/serial v0.1.0
 	github.com/gorilla/mux v1.8.1
 	github.com/joho/godotenv v1.5.1
-	github.com/maja42/goval v1.3.1
+	github.com/mochi-mqtt/server/v2 v2.6.6
 	github.com/mvkvl/modbus v0.1.2
 	github.com/rs/zerolog v1.32.0
 	github.com/xhit/go-str2duration/v2 v2.1.0
 )
 
 require (
-	github.com/goburrow/serial v0.1.0 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
-	golang.org/x/sys v0.12.0 // indirect
+	github.com/rs/xid v1.5.0 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -2,7 +2,6 @@ package main
 
 import (
 	_ "embed"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/gorilla/mux"
@@ -10,10 +9,14 @@ import (
 	"mbridge/bridge"
 	"mbridge/controller"
 	"mbridge/model"
+	"mbridge/mqtt"
+	"mbridge/server"
 	"mbridge/util"
 	"mbridge/util/env"
+	"mbridge/webhook"
 	"net/http"
 	"os"
+	"strings"
 	"syscall"
 )
 
@@ -51,11 +54,84 @@ func main() {
 	bridge.Start()
 
 	go startServer(config, bridge, env.IntOrDefault("SERVICE_PORT", 8080))
+	if modbusServer := startModbusServer(config, bridge); nil != modbusServer {
+		defer modbusServer.Stop()
+	}
+	if passthrough := startPassthrough(config, bridge); nil != passthrough {
+		defer passthrough.Stop()
+	}
+	if publisher := startPublisher(config, bridge); nil != publisher {
+		defer publisher.Stop()
+	}
+	if sender := startWebhooks(config, bridge); nil != sender {
+		defer sender.Stop()
+	}
 
 	util.GetLogger("main").Info("waiting for break signal...")
 	util.HandleSignals(syscall.SIGINT, syscall.SIGTERM)
 	util.GetLogger("main").Info("stop program")
 }
+
+// startModbusServer starts Modbus TCP server exposing cached register values, if it is configured
+func startModbusServer(config *model.Config, br bridge.Bridge) server.Server {
+	if nil == config.ModbusServer {
+		return nil
+	}
+	facade, err := bridge.CreateFacade(config, br)
+	if nil != err {
+		util.GetLogger("main").Error("could not create modbus server: %v", err)
+		return nil
+	}
+	modbusServer := server.CreateServer(config.ModbusServer.GetListen(), server.NewDataHandler(facade))
+	if err := modbusServer.Start(); nil != err {
+		util.GetLogger("main").Error("could not start modbus server: %v", err)
+		return nil
+	}
+	return modbusServer
+}
+
+// startPassthrough starts Modbus TCP listener forwarding requests to channels' slaves, if it is configured
+func startPassthrough(config *model.Config, br bridge.Bridge) server.Server {
+	if nil == config.Passthrough {
+		return nil
+	}
+	passthrough := server.CreateServer(config.Passthrough.GetListen(), bridge.CreatePassthrough(config, br))
+	if err := passthrough.Start(); nil != err {
+		util.GetLogger("main").Error("could not start passthrough: %v", err)
+		return nil
+	}
+	return passthrough
+}
+
+// startPublisher connects MQTT sink to the broker, if it is configured
+func startPublisher(config *model.Config, br bridge.Bridge) mqtt.Publisher {
+	if nil == config.MQTT {
+		return nil
+	}
+	publisher := mqtt.CreatePublisher(config, br)
+	if err := publisher.Start(); nil != err {
+		util.GetLogger("main").Error("could not start mqtt publisher: %v", err)
+		return nil
+	}
+	return publisher
+}
+
+// startWebhooks starts calling webhooks on metrics meeting their triggers, if they are configured
+func startWebhooks(config *model.Config, br bridge.Bridge) webhook.Sender {
+	if nil == config.Webhooks {
+		return nil
+	}
+	sender, err := webhook.CreateSender(config, br)
+	if nil != err {
+		util.GetLogger("main").Error("could not create webhooks: %v", err)
+		return nil
+	}
+	if err := sender.Start(); nil != err {
+		util.GetLogger("main").Error("could not start webhooks: %v", err)
+		return nil
+	}
+	return sender
+}
 func printLogo() {
 	fmt.Println("")
 	fmt.Println(logo)
@@ -73,34 +149,26 @@ func readConfig(path string) *model.Config {
 	if err != nil {
 		panic(err)
 	}
-	var config model.Config
-	if err := json.Unmarshal(content, &config); err != nil {
+	config, err := model.ParseConfig(content)
+	if err != nil {
 		panic(err)
 	}
-	// add back-reference from register to device to channel
-	for i := 0; i < len(config.Channels); i++ {
-		c := config.Channels[i]
-		for j := 0; j < len(c.Devices); j++ {
-			d := c.Devices[j]
-			d.Channel = &c
-			for k := 0; k < len(d.Registers); k++ {
-				d.Registers[k].Device = &d
-			}
-		}
-	}
-	return &config
+	return config
 }
 func printConfig(config *model.Config) {
 	fmt.Printf("ttl: %s,\nprometheus enabled: %t\nchannels:\n", *config.Ttl, config.PrometheusExport)
 	for _, c := range config.Channels {
 		fmt.Printf("\ttitle: %s, conn: %s, mode: %s, cpause: %d, rpause: %d\n",
-			c.Title, c.Connection, c.Mode, c.GetCyclePause(), c.GetRegisterPause())
+			c.Title, strings.Join(c.GetEndpoints(), ","), c.Mode, c.GetCyclePause(), c.GetRegisterPause())
+		if c.Mode.IsSerial() {
+			fmt.Printf("\tserial: %s\n", c.GetSerial())
+		}
 		for _, d := range c.Devices {
 			fmt.Printf("\t\t%s (%s):%d\n", d.Title, d.Alias, d.SlaveId)
 			for _, r := range d.Registers {
 				fmt.Printf(
-					"\t\t\taddr: %4d, size: %2d, type: %7s, mode: %s, factor: %.2f, dev: %s\n",
-					r.Address, r.Size, r.Type, r.Mode, r.Factor, r.Device.Title)
+					"\t\t\taddr: %4d, size: %2d, type: %7s, mode: %s, factor: %.2f, data: %s/%s, dev: %s\n",
+					r.Address, r.Size, r.Type, r.Mode, r.Factor, r.DataType, r.ByteOrder, r.Device.Title)
 			}
 		}
 	}
@@ -114,8 +182,11 @@ func startServer(config *model.Config, bridge bridge.Bridge, port int) {
 	r.HandleFunc("/start", controller.Start).Methods("POST")
 	r.HandleFunc("/stop", controller.Stop).Methods("POST")
 	r.HandleFunc("/registers", controller.Registers).Methods("GET")
+	r.HandleFunc("/devices", controller.Devices).Methods("GET")
+	r.HandleFunc("/channels", controller.Channels).Methods("GET")
 	r.HandleFunc("/metrics", controller.Metrics).Methods("GET")
 	r.HandleFunc("/flush", controller.Flush).Methods("POST")
+	r.HandleFunc("/stream", controller.Stream).Methods("GET")
 	r.HandleFunc("/metric/{metric}", controller.Get).Methods("GET")
 	r.HandleFunc("/metric/{metric}", controller.Write).Methods("POST")
 
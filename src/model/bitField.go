@@ -0,0 +1,77 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// BitField is a named group of bits within a register value, published as a metric of its own
+type BitField struct {
+	Title string `json:"title,omitempty"`
+	Mask  uint64 `json:"mask,omitempty"`
+	Shift uint8  `json:"shift,omitempty"`
+}
+
+func (b BitField) String() string {
+	return fmt.Sprintf("title: %s, mask: 0x%04x, shift: %d", b.Title, b.Mask, b.Shift)
+}
+
+// Extract returns the value of the bit field within the register value
+func (b BitField) Extract(raw uint64) uint64 {
+	return (raw & b.Mask) >> b.Shift
+}
+
+// Insert returns the register value with the bit field replaced by the given value
+func (b BitField) Insert(raw, value uint64) (uint64, error) {
+	shifted := value << b.Shift
+	if shifted&^b.Mask != 0 || shifted>>b.Shift != value {
+		return raw, fmt.Errorf("value %d does not fit bit field '%s' (mask 0x%x)", value, b.Title, b.Mask)
+	}
+	return raw&^b.Mask | shifted, nil
+}
+
+// UnmarshalJSON custom deserializer accepting either a bit index or a mask with an optional shift
+func (b *BitField) UnmarshalJSON(data []byte) (err error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	var field BitField
+
+	if nil != obj["title"] {
+		field.Title = fmt.Sprint(obj["title"])
+	}
+	if "" == field.Title {
+		return fmt.Errorf("bit field title is required")
+	}
+	if nil != obj["bit"] {
+		v, err := strconv.ParseUint(fmt.Sprint(obj["bit"]), 10, 8)
+		if err != nil || v > 63 {
+			return fmt.Errorf("bit field '%s': invalid bit index '%v'", field.Title, obj["bit"])
+		}
+		field.Mask = 1 << v
+		field.Shift = uint8(v)
+	} else if nil != obj["mask"] {
+		// mask may be given either as a number or as a (0x-prefixed) string
+		v, err := strconv.ParseUint(fmt.Sprint(obj["mask"]), 0, 64)
+		if err != nil || v == 0 {
+			return fmt.Errorf("bit field '%s': invalid mask '%v'", field.Title, obj["mask"])
+		}
+		field.Mask = v
+		if nil != obj["shift"] {
+			s, err := strconv.ParseUint(fmt.Sprint(obj["shift"]), 10, 8)
+			if err != nil || s > 63 {
+				return fmt.Errorf("bit field '%s': invalid shift '%v'", field.Title, obj["shift"])
+			}
+			field.Shift = uint8(s)
+		} else {
+			field.Shift = uint8(bits.TrailingZeros64(v))
+		}
+	} else {
+		return fmt.Errorf("bit field '%s': either bit or mask must be set", field.Title)
+	}
+	*b = field
+	return nil
+}
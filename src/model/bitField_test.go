@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBitFieldDeserialization(t *testing.T) {
+	data := []byte(`{"type": "holding", "bits": [{"title": "alarm", "bit": 3}, {"title": "mode", "mask": "0x0030"}]}`)
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if 2 != len(register.Bits) {
+		t.Fatalf("expected 2 bit fields, got %d instead", len(register.Bits))
+	}
+	if 0x08 != register.Bits[0].Mask || 3 != register.Bits[0].Shift {
+		t.Errorf("unexpected bit field: %s", register.Bits[0])
+	}
+	if 0x30 != register.Bits[1].Mask || 4 != register.Bits[1].Shift {
+		t.Errorf("unexpected bit field: %s", register.Bits[1])
+	}
+}
+func TestBitFieldOnCoil(t *testing.T) {
+	data := []byte(`{"type": "coil", "bits": [{"title": "alarm", "bit": 3}]}`)
+	var register Register
+	if err := json.Unmarshal(data, &register); err == nil {
+		t.Errorf("expected error for bit fields on a coil")
+	}
+}
+func TestBitFieldExtractInsert(t *testing.T) {
+	field := BitField{Title: "mode", Mask: 0x30, Shift: 4}
+	if v := field.Extract(0xFFE5); 2 != v {
+		t.Errorf("expected '2', got '%d' instead", v)
+	}
+	v, err := field.Insert(0xFF05, 3)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if 0xFF35 != v {
+		t.Errorf("expected '0xff35', got '%#x' instead", v)
+	}
+	if _, err := field.Insert(0xFF05, 4); err == nil {
+		t.Errorf("expected error for value not fitting the mask")
+	}
+}
+func TestFindBitField(t *testing.T) {
+	data := []byte(`{"channels": [{"title": "c", "devices": [{"title": "d", "registers": [
+		{"title": "status", "type": "holding", "bits": [{"title": "alarm", "bit": 3}]}]}]}]}`)
+	config, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	r, b, err := config.FindBitField("c:d:status.alarm")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if "status" != r.Title || "alarm" != b.Title {
+		t.Errorf("unexpected lookup result: %s / %s", r.Title, b.Title)
+	}
+	if _, _, err := config.FindBitField("c:d:status.missing"); err == nil {
+		t.Errorf("expected error for unknown bit field")
+	}
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ByteOrder describes how a multi-word value is laid out on the bus,
+// 'A' being the most significant byte of the value
+type ByteOrder uint8
+
+const (
+	ABCD ByteOrder = iota + 1
+	CDAB
+	BADC
+	DCBA
+)
+
+var (
+	byteOrderName = map[uint8]string{
+		1: "ABCD",
+		2: "CDAB",
+		3: "BADC",
+		4: "DCBA",
+	}
+	byteOrderValue = map[string]uint8{
+		"ABCD": 1,
+		"CDAB": 2,
+		"BADC": 3,
+		"DCBA": 4,
+	}
+)
+
+func parseByteOrder(s string) (ByteOrder, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	value, ok := byteOrderValue[s]
+	if !ok {
+		return ByteOrder(0), fmt.Errorf("%q is not a valid byte order", s)
+	}
+	return ByteOrder(value), nil
+}
+
+// SwapWords reports whether the words of a value are sent least significant first
+func (o ByteOrder) SwapWords() bool {
+	return o == CDAB || o == DCBA
+}
+
+// SwapBytes reports whether the bytes within each word are sent least significant first
+func (o ByteOrder) SwapBytes() bool {
+	return o == BADC || o == DCBA
+}
+
+// Apply reorders bus data into big-endian (ABCD) order and vice versa;
+// the conversion is symmetric, so the same call is used for reading and writing
+func (o ByteOrder) Apply(buff []byte) []byte {
+	words := len(buff) / 2
+	result := make([]byte, words*2)
+	for i := 0; i < words; i++ {
+		j := i
+		if o.SwapWords() {
+			j = words - 1 - i
+		}
+		if o.SwapBytes() {
+			result[j*2], result[j*2+1] = buff[i*2+1], buff[i*2]
+		} else {
+			result[j*2], result[j*2+1] = buff[i*2], buff[i*2+1]
+		}
+	}
+	return result
+}
+func (o ByteOrder) String() string {
+	return byteOrderName[uint8(o)]
+}
+func (o ByteOrder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+func (o *ByteOrder) UnmarshalJSON(data []byte) (err error) {
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	if *o, err = parseByteOrder(input); err != nil {
+		return err
+	}
+	return nil
+}
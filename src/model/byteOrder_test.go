@@ -0,0 +1,37 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestByteOrderValueDeserialization(t *testing.T) {
+	exp := CDAB
+	data := []byte("{\"type\": \"input\", \"data_type\": \"float32\", \"byte_order\": \"cdab\"}")
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp != register.ByteOrder {
+		t.Errorf("expected byte order %d (%s), got %d instead", exp, byteOrderName[uint8(exp)], register.ByteOrder)
+	}
+}
+func TestByteOrderApply(t *testing.T) {
+	bus := []byte{0x01, 0x02, 0x03, 0x04}
+	tests := map[ByteOrder][]byte{
+		ABCD: {0x01, 0x02, 0x03, 0x04},
+		CDAB: {0x03, 0x04, 0x01, 0x02},
+		BADC: {0x02, 0x01, 0x04, 0x03},
+		DCBA: {0x04, 0x03, 0x02, 0x01},
+	}
+	for order, exp := range tests {
+		res := order.Apply(bus)
+		if !bytes.Equal(exp, res) {
+			t.Errorf("%s: expected '% x', got '% x' instead", order, exp, res)
+		}
+		if back := order.Apply(res); !bytes.Equal(bus, back) {
+			t.Errorf("%s: expected symmetric conversion, got '% x'", order, back)
+		}
+	}
+}
@@ -1,28 +1,59 @@
 package model
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
 const (
 	defaultCyclePollPause    = time.Millisecond * 100
 	defaultRegisterPollPause = time.Millisecond * 10
+	defaultWriteTimeout      = time.Second * 5
+	defaultReadTimeout       = time.Second * 5
+	defaultMaxReadGap        = 0
+	defaultMaxReadBlock      = 32
+	defaultWriteQueueDepth   = 16
+	defaultQueryQueueDepth   = 16
+	defaultPollQueueDepth    = 64
+	defaultQueueMaxSkip      = 8
+	defaultOfflineThreshold  = 3
+	defaultOfflineBackoff    = time.Second
+	defaultOfflineMaxBackoff = time.Minute
+	defaultFailoverThreshold = 3
+	defaultFailbackInterval  = time.Minute
+
+	// protocol limits of a single read request
+	maxReadRegisters = 125
+	maxReadBits      = 2000
 )
 
 type Channel struct {
-	Mode          Mode     `json:"mode,omitempty"`
-	Title         string   `json:"title,omitempty"`
-	Connection    string   `json:"connection,omitempty"`
-	CyclePause    *string  `json:"cycle_pause,omitempty"`
-	RegisterPause *string  `json:"register_pause,omitempty"`
-	Devices       []Device `json:"devices,omitempty"`
+	Mode          Mode         `json:"mode,omitempty"`
+	Title         string       `json:"title,omitempty"`
+	Connection    string       `json:"connection,omitempty"`
+	Connections   []string     `json:"connections,omitempty"`
+	Failover      *Failover    `json:"failover,omitempty"`
+	CyclePause    *string      `json:"cycle_pause,omitempty"`
+	RegisterPause *string      `json:"register_pause,omitempty"`
+	WriteTimeout  *string      `json:"write_timeout,omitempty"`
+	ReadTimeout   *string      `json:"read_timeout,omitempty"`
+	MaxReadGap    *uint16      `json:"max_read_gap,omitempty"`
+	MaxReadBlock  *uint16      `json:"max_read_block,omitempty"`
+	Queue         *Queue       `json:"queue,omitempty"`
+	Offline       *Offline     `json:"offline,omitempty"`
+	Serial        *Serial      `json:"serial,omitempty"`
+	TLS           *TLSSettings `json:"tls,omitempty"`
+	Devices       []Device     `json:"devices,omitempty"`
+	Timing
 }
 
 func (c Channel) String() string {
 	return fmt.Sprintf(
 		"mode: %s, conn: %s, devices: %d, cpause: %d, rpause: %d",
-		c.Mode, c.Connection, len(c.Devices), c.GetCyclePause(), c.GetRegisterPause(),
+		c.Mode, strings.Join(c.GetEndpoints(), ","), len(c.Devices), c.GetCyclePause(), c.GetRegisterPause(),
 	)
 }
 
@@ -34,6 +65,173 @@ func (c Channel) GetRegisterPause() time.Duration {
 	return durationOrDefault(c.RegisterPause, defaultRegisterPollPause)
 }
 
+// GetWriteTimeout returns how long a write waits for the bus before giving up; a write the executor has
+// taken is awaited beyond it, as device's timeout, retries & retry delays bound its execution
+func (c Channel) GetWriteTimeout() time.Duration {
+	return durationOrDefault(c.WriteTimeout, defaultWriteTimeout)
+}
+
+// GetReadTimeout returns how long an on-demand read waits for the bus before giving up; like a write,
+// a read being executed is awaited beyond it
+func (c Channel) GetReadTimeout() time.Duration {
+	return durationOrDefault(c.ReadTimeout, defaultReadTimeout)
+}
+
+// GetMaxReadGap returns the number of unconfigured addresses a block read may span
+// between two registers; zero means only contiguous registers are read together
+func (c Channel) GetMaxReadGap() uint16 {
+	if c.MaxReadGap == nil {
+		return defaultMaxReadGap
+	}
+	return *c.MaxReadGap
+}
+
+// GetMaxReadBlock returns the maximum quantity of a block read for the register type;
+// one disables read coalescing
+func (c Channel) GetMaxReadBlock(t RegType) uint16 {
+	limit := uint16(maxReadRegisters)
+	if t == COIL || t == DISCRETE {
+		limit = maxReadBits
+	}
+	if c.MaxReadBlock == nil {
+		return min(defaultMaxReadBlock, limit)
+	}
+	return max(1, min(*c.MaxReadBlock, limit))
+}
+
+// Queue configures channel's command queues: the number of writes, on-demand reads and
+// background polls waiting for the bus, and how many times in a row a waiting level may be
+// passed over by higher priority commands before it is served
+type Queue struct {
+	WriteDepth *int `json:"write_depth,omitempty"`
+	QueryDepth *int `json:"query_depth,omitempty"`
+	PollDepth  *int `json:"poll_depth,omitempty"`
+	MaxSkip    *int `json:"max_skip,omitempty"`
+}
+
+// GetWriteQueueDepth returns the number of writes which may wait for the bus; further ones are rejected
+func (c Channel) GetWriteQueueDepth() int {
+	if c.Queue == nil {
+		return defaultWriteQueueDepth
+	}
+	return intOrDefault(c.Queue.WriteDepth, defaultWriteQueueDepth)
+}
+
+// GetQueryQueueDepth returns the number of on-demand reads which may wait for the bus; further ones are rejected
+func (c Channel) GetQueryQueueDepth() int {
+	if c.Queue == nil {
+		return defaultQueryQueueDepth
+	}
+	return intOrDefault(c.Queue.QueryDepth, defaultQueryQueueDepth)
+}
+
+// GetPollQueueDepth returns the number of background polls which may wait for the bus; the poller blocks beyond it
+func (c Channel) GetPollQueueDepth() int {
+	if c.Queue == nil {
+		return defaultPollQueueDepth
+	}
+	return intOrDefault(c.Queue.PollDepth, defaultPollQueueDepth)
+}
+
+// GetQueueMaxSkip returns how many commands of higher priority may go ahead of a waiting one
+func (c Channel) GetQueueMaxSkip() int {
+	if c.Queue == nil {
+		return defaultQueueMaxSkip
+	}
+	return intOrDefault(c.Queue.MaxSkip, defaultQueueMaxSkip)
+}
+
+// Offline configures detection of unresponsive devices: after threshold consecutive failures
+// a device is not polled anymore, but probed with back-off doubling from backoff up to max_backoff
+type Offline struct {
+	Threshold  *int    `json:"threshold,omitempty"`
+	Backoff    *string `json:"backoff,omitempty"`
+	MaxBackoff *string `json:"max_backoff,omitempty"`
+}
+
+// GetOfflineThreshold returns the number of consecutive failures after which a device is considered offline
+func (c Channel) GetOfflineThreshold() int {
+	if c.Offline == nil {
+		return defaultOfflineThreshold
+	}
+	return intOrDefault(c.Offline.Threshold, defaultOfflineThreshold)
+}
+
+// GetOfflineBackoff returns the initial and the maximum pause between probes of an offline device
+func (c Channel) GetOfflineBackoff() (initial, maximum time.Duration) {
+	if c.Offline == nil {
+		return defaultOfflineBackoff, defaultOfflineMaxBackoff
+	}
+	initial = durationOrDefault(c.Offline.Backoff, defaultOfflineBackoff)
+	maximum = durationOrDefault(c.Offline.MaxBackoff, defaultOfflineMaxBackoff)
+	return initial, max(initial, maximum)
+}
+
+// Failover configures switching between channel's connections: after threshold consecutive
+// connection failures the next connection is used, the primary one is retried after failback;
+// a device not answering in time is not a connection failure, other devices may answer on the connection
+type Failover struct {
+	Threshold *int    `json:"threshold,omitempty"`
+	Failback  *string `json:"failback,omitempty"`
+}
+
+// GetEndpoints returns channel's connections, the primary one first
+func (c Channel) GetEndpoints() []string {
+	if len(c.Connections) > 0 {
+		return c.Connections
+	}
+	return []string{c.Connection}
+}
+
+// GetFailoverThreshold returns the number of consecutive connection failures after which the next connection is used
+func (c Channel) GetFailoverThreshold() int {
+	if c.Failover == nil {
+		return defaultFailoverThreshold
+	}
+	return intOrDefault(c.Failover.Threshold, defaultFailoverThreshold)
+}
+
+// GetFailbackInterval returns how long a secondary connection is used before the primary one is retried
+func (c Channel) GetFailbackInterval() time.Duration {
+	if c.Failover == nil {
+		return defaultFailbackInterval
+	}
+	return durationOrDefault(c.Failover.Failback, defaultFailbackInterval)
+}
+
+// validateEndpoints checks that the channel has either a connection or a list of them
+func (c Channel) validateEndpoints() error {
+	if c.Connection != "" && len(c.Connections) > 0 {
+		return errors.New("either connection or connections can be set, not both")
+	}
+	if len(c.Connections) > 0 && slices.Contains(c.Connections, "") {
+		return errors.New("empty connection in connections")
+	}
+	return nil
+}
+
+// GetSerial returns line settings of a serial channel
+func (c Channel) GetSerial() Serial {
+	if c.Serial == nil {
+		return Serial{}
+	}
+	return *c.Serial
+}
+
+// validateSerial checks that line settings are given for serial channels only & are supported
+func (c Channel) validateSerial() error {
+	if c.Serial == nil {
+		return nil
+	}
+	if !c.Mode.IsSerial() {
+		return fmt.Errorf("serial settings can not be used in %s mode", c.Mode)
+	}
+	if err := c.Serial.validate(c.Mode); err != nil {
+		return fmt.Errorf("serial: %w", err)
+	}
+	return nil
+}
+
 func (c Channel) findDeviceByTitle(title string) (*Device, error) {
 	for _, v := range c.Devices {
 		if v.Title == title {
@@ -0,0 +1,10 @@
+package model
+
+// ChannelState is channel's connection as seen by the bridge
+type ChannelState struct {
+	Channel   string   `json:"channel"`
+	Mode      Mode     `json:"mode"`
+	Endpoint  string   `json:"endpoint"`
+	Primary   bool     `json:"primary"`
+	Endpoints []string `json:"endpoints"`
+}
@@ -16,3 +16,10 @@ func durationOrDefault(input *string, defaultDuration time.Duration) time.Durati
 		return v
 	}
 }
+
+func intOrDefault(value *int, defaultValue int) int {
+	if value == nil || *value < 1 {
+		return defaultValue
+	}
+	return *value
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -9,14 +10,95 @@ import (
 const defaultMetricTTL = time.Second * 30
 
 type Config struct {
-	Ttl              *string   `json:"ttl,omitempty"`
-	PrometheusExport bool      `json:"export_prometheus,omitempty"`
-	Channels         []Channel `json:"channels,omitempty"`
+	Ttl              *string           `json:"ttl,omitempty"`
+	PrometheusExport bool              `json:"export_prometheus,omitempty"`
+	PollClasses      map[string]string `json:"poll_classes,omitempty"`
+	Channels         []Channel         `json:"channels,omitempty"`
+	ModbusServer     *ModbusServer     `json:"modbus_server,omitempty"`
+	Passthrough      *Passthrough      `json:"passthrough,omitempty"`
+	MQTT             *MQTT             `json:"mqtt,omitempty"`
+	Webhooks         *Webhooks         `json:"webhooks,omitempty"`
 }
 
 func (config *Config) GetTTL() time.Duration {
 	return durationOrDefault(config.Ttl, defaultMetricTTL)
 }
+
+// Validate checks settings which can only be verified with the whole configuration loaded
+func (config *Config) Validate() error {
+	for _, c := range config.Channels {
+		if err := c.Timing.validate(); err != nil {
+			return fmt.Errorf("%s: %w", c.Title, err)
+		}
+		if err := c.validateEndpoints(); err != nil {
+			return fmt.Errorf("%s: %w", c.Title, err)
+		}
+		if err := c.validateSerial(); err != nil {
+			return fmt.Errorf("%s: %w", c.Title, err)
+		}
+		if err := c.validateTLS(); err != nil {
+			return fmt.Errorf("%s: %w", c.Title, err)
+		}
+		for _, d := range c.Devices {
+			if err := d.Timing.validate(); err != nil {
+				return fmt.Errorf("%s:%s: %w", c.Title, d.Title, err)
+			}
+			for _, r := range d.Registers {
+				if _, _, err := config.GetPollInterval(&r); err != nil {
+					return fmt.Errorf("%s:%s: %w", c.Title, d.Title, err)
+				}
+			}
+		}
+	}
+	if nil != config.ModbusServer {
+		if err := config.ModbusServer.validate(config); err != nil {
+			return fmt.Errorf("modbus server: %w", err)
+		}
+	}
+	if nil != config.Passthrough {
+		if err := config.Passthrough.validate(config); err != nil {
+			return fmt.Errorf("passthrough: %w", err)
+		}
+	}
+	if nil != config.MQTT {
+		if err := config.MQTT.validate(); err != nil {
+			return fmt.Errorf("mqtt: %w", err)
+		}
+	}
+	if nil != config.Webhooks {
+		if err := config.Webhooks.validate(config); err != nil {
+			return fmt.Errorf("webhooks: %w", err)
+		}
+	}
+	return nil
+}
+
+// ParseConfig reads the configuration from JSON, links its back-references & validates it
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	config.Link()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Link sets back-references of the loaded configuration: from registers to their devices & from devices to their channels
+func (config *Config) Link() {
+	for i := range config.Channels {
+		c := &config.Channels[i]
+		for j := range c.Devices {
+			d := &c.Devices[j]
+			d.Channel = c
+			for k := range d.Registers {
+				d.Registers[k].Device = d
+			}
+		}
+	}
+}
 func (config *Config) FindChannelByTitle(title string) (*Channel, error) {
 	for _, v := range config.Channels {
 		if v.Title == title {
@@ -41,3 +123,21 @@ func (config *Config) FindRegister(reference string) (*Register, error) {
 	r, err := d.findRegisterByTitle(strings.TrimSpace(ref[2]))
 	return r, err
 }
+
+// FindBitField resolves a 'channel:device:register.bit' reference into the register and its bit field
+func (config *Config) FindBitField(reference string) (*Register, *BitField, error) {
+	ref := strings.Split(reference, ":")
+	if 3 != len(ref) {
+		return nil, nil, fmt.Errorf("invalid reference passed: '%s'", reference)
+	}
+	idx := strings.LastIndex(ref[2], ".")
+	if idx < 0 {
+		return nil, nil, fmt.Errorf("not a bit field reference: '%s'", reference)
+	}
+	r, err := config.FindRegister(fmt.Sprintf("%s:%s:%s", ref[0], ref[1], ref[2][:idx]))
+	if nil != err {
+		return nil, nil, err
+	}
+	b, err := r.findBitFieldByTitle(strings.TrimSpace(ref[2][idx+1:]))
+	return r, b, err
+}
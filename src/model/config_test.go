@@ -0,0 +1,37 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+)
+
+// validityTest is a part of a configuration & whether the configuration with it is valid
+type validityTest struct {
+	part  string
+	valid bool
+}
+
+// testValidity puts the part of each test into the layout & checks whether the configuration is valid
+func testValidity(t *testing.T, layout string, tests []validityTest) {
+	t.Helper()
+	for _, test := range tests {
+		if _, err := ParseConfig([]byte(fmt.Sprintf(layout, test.part))); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid '%t', got '%v'", test.part, test.valid, err)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"channels": [{"title": "c", "devices": [{"title": "d", "registers": [{"title": "r"}]}]}]}`))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if r := &config.Channels[0].Devices[0].Registers[0]; r.Device != &config.Channels[0].Devices[0] || r.Device.Channel != &config.Channels[0] {
+		t.Error("expected back-references to be linked")
+	}
+	for _, data := range []string{`{"channels": [`, `{"channels": [{"title": "c", "mode": "serial"}]}`} {
+		if _, err := ParseConfig([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", data)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type DataType uint8
+
+const (
+	INT16 DataType = iota + 1
+	UINT16
+	INT32
+	UINT32
+	FLOAT32
+	INT64
+	UINT64
+	FLOAT64
+	STRING
+)
+
+var (
+	dataTypeName = map[uint8]string{
+		1: "int16",
+		2: "uint16",
+		3: "int32",
+		4: "uint32",
+		5: "float32",
+		6: "int64",
+		7: "uint64",
+		8: "float64",
+		9: "string",
+	}
+	dataTypeValue = map[string]uint8{
+		"int16":   1,
+		"uint16":  2,
+		"int32":   3,
+		"uint32":  4,
+		"float32": 5,
+		"int64":   6,
+		"uint64":  7,
+		"float64": 8,
+		"string":  9,
+	}
+	dataTypeWords = map[uint8]uint16{
+		1: 1,
+		2: 1,
+		3: 2,
+		4: 2,
+		5: 2,
+		6: 4,
+		7: 4,
+		8: 4,
+	}
+)
+
+func parseDataType(s string) (DataType, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	value, ok := dataTypeValue[s]
+	if !ok {
+		return DataType(0), fmt.Errorf("%q is not a valid register data type", s)
+	}
+	return DataType(value), nil
+}
+
+// Words returns the number of 16-bit registers occupied by a value of the data type;
+// strings have no fixed length and report zero
+func (t DataType) Words() uint16 {
+	return dataTypeWords[uint8(t)]
+}
+func (t DataType) String() string {
+	return dataTypeName[uint8(t)]
+}
+func (t DataType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+func (t *DataType) UnmarshalJSON(data []byte) (err error) {
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	if *t, err = parseDataType(input); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDataTypeValueSerialization(t *testing.T) {
+	var dt = FLOAT32
+	exp := "\"float32\""
+	data, _ := json.Marshal(dt)
+	res := string(data)
+	if res != exp {
+		t.Errorf("expected '%s', got '%s' instead", exp, res)
+	}
+}
+func TestDataTypeValueDeserialization(t *testing.T) {
+	exp := INT32
+	data := []byte("{\"type\": \"holding\", \"data_type\": \"int32\"}")
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if exp != register.DataType {
+		t.Errorf("expected data type %d (%s), got %d instead", exp, dataTypeName[uint8(exp)], register.DataType)
+	}
+	if 2 != register.Size {
+		t.Errorf("expected size '2', got '%d' instead", register.Size)
+	}
+}
+func TestDataTypeDefaults(t *testing.T) {
+	data := []byte("{\"type\": \"input\", \"size\": 2}")
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if UINT32 != register.DataType {
+		t.Errorf("expected data type '%s', got '%s' instead", UINT32, register.DataType)
+	}
+	if ABCD != register.ByteOrder {
+		t.Errorf("expected byte order '%s', got '%s' instead", ABCD, register.ByteOrder)
+	}
+}
+func TestDataTypeSizeMismatch(t *testing.T) {
+	data := []byte("{\"type\": \"input\", \"size\": 1, \"data_type\": \"float64\"}")
+	var register Register
+	if err := json.Unmarshal(data, &register); err == nil {
+		t.Errorf("expected error for too small register size")
+	}
+}
+func TestStringDataTypeDeserialization(t *testing.T) {
+	data := []byte("{\"type\": \"holding\", \"data_type\": \"string\", \"size\": 8, \"swap_bytes\": true}")
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if STRING != register.DataType || 8 != register.Size || !register.SwapBytes || !register.Trim {
+		t.Errorf("unexpected string register: %s, swap: %t, trim: %t", register, register.SwapBytes, register.Trim)
+	}
+	data = []byte("{\"type\": \"holding\", \"data_type\": \"string\"}")
+	if err := json.Unmarshal(data, &register); err == nil {
+		t.Errorf("expected error for string register without size")
+	}
+}
@@ -12,6 +12,8 @@ type Device struct {
 	Title     string     `json:"title,omitempty"`
 	Alias     string     `json:"alias,omitempty"`
 	Registers []Register `json:"registers,omitempty"`
+	PollSettings
+	Timing
 }
 
 func (d *Device) findRegisterByTitle(title string) (*Register, error) {
@@ -42,6 +44,8 @@ func (d *Device) UnmarshalJSON(data []byte) (err error) {
 		v, _ := strconv.Atoi(fmt.Sprint(obj["slave_id"]))
 		device.SlaveId = uint8(v)
 	}
+	device.PollSettings = parsePollSettings(obj)
+	device.Timing = parseTiming(obj)
 	if nil != obj["registers"] {
 		r := obj["registers"]
 		rj, err := json.Marshal(r)
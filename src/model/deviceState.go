@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// DeviceState is device's availability as seen by the bridge
+type DeviceState struct {
+	Channel   string     `json:"channel"`
+	Device    string     `json:"device"`
+	Alias     string     `json:"alias"`
+	Online    bool       `json:"online"`
+	Failures  int        `json:"failures"`
+	Since     time.Time  `json:"since"`
+	NextProbe *time.Time `json:"next_probe,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
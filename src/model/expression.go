@@ -0,0 +1,51 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"math"
+)
+
+// Expression is a value conversion formula compiled once at configuration load
+type Expression struct {
+	source  string
+	program *vm.Program
+}
+
+// CompileExpression compiles the formula; 'raw', 'value', 'factor' and the given
+// variables are the only identifiers it may reference
+func CompileExpression(source string, variables map[string]float64) (*Expression, error) {
+	program, err := expr.Compile(source, expr.Env(expressionEnv(0, 0, 1, variables)), expr.AsFloat64())
+	if err != nil {
+		return nil, fmt.Errorf("could not compile expression '%s': %w", source, err)
+	}
+	return &Expression{source: source, program: program}, nil
+}
+
+// Evaluate runs the formula for the given raw (register) or value (engineering) input
+func (e *Expression) Evaluate(raw, value float64, factor float64, variables map[string]float64) (float64, error) {
+	out, err := expr.Run(e.program, expressionEnv(raw, value, factor, variables))
+	if err != nil {
+		return math.NaN(), fmt.Errorf("could not evaluate expression '%s': %w", e.source, err)
+	}
+	return out.(float64), nil
+}
+func (e *Expression) String() string {
+	return e.source
+}
+func (e *Expression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.source)
+}
+
+func expressionEnv(raw, value float64, factor float64, variables map[string]float64) map[string]interface{} {
+	env := make(map[string]interface{}, len(variables)+3)
+	for k, v := range variables {
+		env[k] = v
+	}
+	env["raw"] = raw
+	env["value"] = value
+	env["factor"] = factor
+	return env
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRegisterTransform(t *testing.T) {
+	data := []byte(`{"type": "input", "transform": "(raw - offset) / 16000 * 100", "variables": {"offset": 4000}}`)
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	v, err := register.ToValue(12000)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if 50 != v {
+		t.Errorf("expected '50', got '%f' instead", v)
+	}
+}
+func TestRegisterConditionalTransform(t *testing.T) {
+	data := []byte(`{"type": "input", "transform": "raw > 32767 ? raw - 65536 : raw"}`)
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	tests := map[float64]float64{65535: -1, 100: 100}
+	for raw, exp := range tests {
+		v, err := register.ToValue(raw)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if exp != v {
+			t.Errorf("expected '%f', got '%f' instead", exp, v)
+		}
+	}
+}
+func TestRegisterInverseTransform(t *testing.T) {
+	data := []byte(`{"type": "holding", "transform": "raw * factor + 10", "inverse_transform": "(value - 10) / factor", "factor": 0.5}`)
+	var register Register
+	if err := json.Unmarshal(data, &register); err != nil {
+		t.Fatalf("%s", err)
+	}
+	v, err := register.ToRaw(20)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if 20 != v {
+		t.Errorf("expected '20', got '%f' instead", v)
+	}
+}
+func TestRegisterDefaultTransform(t *testing.T) {
+	register := Register{Factor: 0.1}
+	if v, _ := register.ToValue(225); 22.5 != v {
+		t.Errorf("expected '22.5', got '%f' instead", v)
+	}
+	if v, _ := register.ToRaw(22.5); 225 != v {
+		t.Errorf("expected '225', got '%f' instead", v)
+	}
+}
+func TestRegisterTransformErrors(t *testing.T) {
+	tests := []string{
+		`{"type": "input", "transform": "raw * unknown"}`,
+		`{"type": "input", "transform": "raw *"}`,
+		`{"type": "holding", "transform": "raw * 2"}`,
+	}
+	for _, data := range tests {
+		var register Register
+		if err := json.Unmarshal([]byte(data), &register); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
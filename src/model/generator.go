@@ -0,0 +1,60 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Generator is the way a simulated register's value changes over time
+type Generator uint8
+
+const (
+	CONSTANT Generator = iota + 1
+	RAMP
+	SINE
+	RANDOM_WALK
+	TOGGLE
+)
+
+var (
+	generatorName = map[uint8]string{
+		1: "constant",
+		2: "ramp",
+		3: "sine",
+		4: "random_walk",
+		5: "toggle",
+	}
+	generatorValue = map[string]uint8{
+		"constant":    1,
+		"ramp":        2,
+		"sine":        3,
+		"random_walk": 4,
+		"toggle":      5,
+	}
+)
+
+func parseGenerator(s string) (Generator, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	value, ok := generatorValue[s]
+	if !ok {
+		return Generator(0), fmt.Errorf("%q is not a valid generator", s)
+	}
+	return Generator(value), nil
+}
+func (g Generator) String() string {
+	return generatorName[uint8(g)]
+}
+func (g Generator) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.String())
+}
+func (g *Generator) UnmarshalJSON(data []byte) (err error) {
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	if *g, err = parseGenerator(input); err != nil {
+		return err
+	}
+	return nil
+}
@@ -13,15 +13,28 @@ type Metric struct {
 	Register  string    `json:"register"`
 	RawValue  any       `json:"raw"`
 	Value     float64   `json:"value"`
+	Text      string    `json:"text,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
 func (m Metric) IsExpired(ttl time.Duration) bool {
 	return m.Timestamp.Add(ttl).Before(time.Now())
 }
+
+// IsText reports whether the metric carries a string value instead of a number
+func (m Metric) IsText() bool {
+	_, ok := m.RawValue.(string)
+	return ok
+}
 func (m Metric) String() string {
-	return fmt.Sprintf("key: %-30s raw: %-10d val: %-10.2f ts: %s", m.Key, m.RawValue, m.Value, m.Timestamp.Format("2006-01-02 15:04:05.000"))
+	if m.IsText() {
+		return fmt.Sprintf("key: %-30s text: %-21q ts: %s", m.Key, m.Text, m.Timestamp.Format("2006-01-02 15:04:05.000"))
+	}
+	return fmt.Sprintf("key: %-30s raw: %-10v val: %-10.2f ts: %s", m.Key, m.RawValue, m.Value, m.Timestamp.Format("2006-01-02 15:04:05.000"))
 }
 func MetricKey(register *Register) string {
 	return fmt.Sprintf("%s:%s:%s", register.Device.Channel.Title, register.Device.Title, register.Title)
 }
+func BitMetricKey(register *Register, field *BitField) string {
+	return fmt.Sprintf("%s.%s", MetricKey(register), field.Title)
+}
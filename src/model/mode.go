@@ -12,6 +12,11 @@ const (
 	RTU Mode = iota + 1
 	TCP
 	ENC
+	ASCII
+	UDP
+	TLS
+	// SIM channels talk to an in-memory slave built from the channel's devices
+	SIM
 )
 
 var (
@@ -19,11 +24,19 @@ var (
 		1: "rtu",
 		2: "tcp",
 		3: "enc",
+		4: "ascii",
+		5: "udp",
+		6: "tls",
+		7: "sim",
 	}
 	modeValue = map[string]uint8{
-		"rtu": 1,
-		"tcp": 2,
-		"enc": 3,
+		"rtu":   1,
+		"tcp":   2,
+		"enc":   3,
+		"ascii": 4,
+		"udp":   5,
+		"tls":   6,
+		"sim":   7,
 	}
 )
 
@@ -38,6 +51,11 @@ func parseMode(s string) (Mode, error) {
 func (m Mode) String() string {
 	return modeName[uint8(m)]
 }
+
+// IsSerial reports whether the mode talks to a serial line rather than a network connection
+func (m Mode) IsSerial() bool {
+	return m == RTU || m == ASCII
+}
 func (m Mode) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m.String())
 }
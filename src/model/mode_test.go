@@ -25,3 +25,14 @@ func TestModeValueDeserialization(t *testing.T) {
 		t.Errorf("expected mode %d (%s), got %d instead", exp, modeName[uint8(exp)], channel.Mode)
 	}
 }
+func TestModeNames(t *testing.T) {
+	for _, mode := range []Mode{RTU, TCP, ENC, ASCII, UDP, TLS, SIM} {
+		parsed, err := parseMode(mode.String())
+		if err != nil || mode != parsed {
+			t.Errorf("expected mode '%s' to round trip, got '%s' (%v)", mode, parsed, err)
+		}
+	}
+	if !ASCII.IsSerial() || UDP.IsSerial() {
+		t.Error("expected only ASCII to be a serial mode")
+	}
+}
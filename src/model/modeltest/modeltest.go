@@ -0,0 +1,17 @@
+// Package modeltest provides configurations to tests of packages built on the model
+package modeltest
+
+import (
+	"mbridge/model"
+	"testing"
+)
+
+// Config parses the configuration from JSON, failing the test if it can not be parsed or is not valid
+func Config(t testing.TB, data string) *model.Config {
+	t.Helper()
+	config, err := model.ParseConfig([]byte(data))
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	return config
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultMqttClientId    = "mbridge"
+	defaultMqttTopic       = "mbridge"
+	defaultDiscoveryPrefix = "homeassistant"
+
+	// PayloadJSON publishes metrics as JSON objects, PayloadPlain as bare values
+	PayloadJSON  = "json"
+	PayloadPlain = "plain"
+	// PublishChange publishes metrics whose raw value changed, PublishPoll every value read
+	PublishChange = "change"
+	PublishPoll   = "poll"
+)
+
+// MQTT configures the MQTT sink: metrics are published to <topic>/<channel>/<device alias>/<register>,
+// values written to <metric topic>/set are sent to the register & <topic>/status carries availability
+type MQTT struct {
+	Broker    string     `json:"broker"`
+	ClientId  string     `json:"client_id,omitempty"`
+	Username  string     `json:"username,omitempty"`
+	Password  string     `json:"password,omitempty"`
+	Topic     string     `json:"topic,omitempty"`
+	Payload   string     `json:"payload,omitempty"`
+	Publish   string     `json:"publish,omitempty"`
+	Retain    *bool      `json:"retain,omitempty"`
+	QoS       *int       `json:"qos,omitempty"`
+	Discovery *Discovery `json:"discovery,omitempty"`
+}
+
+// Discovery enables Home Assistant MQTT discovery of configured registers
+type Discovery struct {
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// GetPrefix returns the topic prefix Home Assistant listens to for discovery
+func (d Discovery) GetPrefix() string {
+	if d.Prefix == "" {
+		return defaultDiscoveryPrefix
+	}
+	return strings.TrimSuffix(d.Prefix, "/")
+}
+
+func (m MQTT) GetClientId() string {
+	if m.ClientId == "" {
+		return defaultMqttClientId
+	}
+	return m.ClientId
+}
+
+// GetTopic returns the root of the sink's topics
+func (m MQTT) GetTopic() string {
+	if m.Topic == "" {
+		return defaultMqttTopic
+	}
+	return strings.TrimSuffix(m.Topic, "/")
+}
+func (m MQTT) GetPayload() string {
+	if m.Payload == "" {
+		return PayloadJSON
+	}
+	return m.Payload
+}
+func (m MQTT) GetPublish() string {
+	if m.Publish == "" {
+		return PublishChange
+	}
+	return m.Publish
+}
+
+// IsRetained reports whether metrics are published as retained messages, which they are by default
+func (m MQTT) IsRetained() bool {
+	return m.Retain == nil || *m.Retain
+}
+func (m MQTT) GetQoS() byte {
+	if m.QoS == nil {
+		return 0
+	}
+	return byte(*m.QoS)
+}
+
+func (m MQTT) validate() error {
+	if m.Broker == "" {
+		return errors.New("broker is required")
+	}
+	if m.GetPayload() != PayloadJSON && m.GetPayload() != PayloadPlain {
+		return fmt.Errorf("%q is not a valid payload format", m.Payload)
+	}
+	if m.GetPublish() != PublishChange && m.GetPublish() != PublishPoll {
+		return fmt.Errorf("%q is not a valid publish mode", m.Publish)
+	}
+	if m.QoS != nil && (*m.QoS < 0 || *m.QoS > 2) {
+		return fmt.Errorf("invalid qos %d", *m.QoS)
+	}
+	if strings.ContainsAny(m.GetTopic(), "+#") {
+		return fmt.Errorf("topic %q contains wildcards", m.Topic)
+	}
+	if nil != m.Discovery && strings.ContainsAny(m.Discovery.GetPrefix(), "+#") {
+		return fmt.Errorf("discovery prefix %q contains wildcards", m.Discovery.Prefix)
+	}
+	return nil
+}
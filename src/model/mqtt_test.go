@@ -0,0 +1,22 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestMQTTValidate(t *testing.T) {
+	testValidity(t, `{"mqtt": %s}`, []validityTest{
+		{`{"broker": "tcp://localhost:1883"}`, true},
+		{`{"broker": "tcp://localhost:1883", "payload": "plain", "publish": "poll", "qos": 1}`, true},
+		{`{}`, false},
+		{`{"broker": "tcp://localhost:1883", "payload": "xml"}`, false},
+		{`{"broker": "tcp://localhost:1883", "publish": "always"}`, false},
+		{`{"broker": "tcp://localhost:1883", "qos": 3}`, false},
+		{`{"broker": "tcp://localhost:1883", "topic": "home/#"}`, false},
+		{`{"broker": "tcp://localhost:1883", "discovery": {"prefix": "ha/+"}}`, false},
+	})
+	var settings MQTT
+	if settings.GetTopic() != "mbridge" || !settings.IsRetained() || settings.GetPayload() != PayloadJSON || settings.GetPublish() != PublishChange {
+		t.Errorf("unexpected defaults: %+v", settings)
+	}
+}
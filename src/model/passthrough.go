@@ -0,0 +1,40 @@
+package model
+
+import "fmt"
+
+const defaultPassthroughListen = ":5020"
+
+// Passthrough configures the Modbus TCP listener forwarding requests as is to the channels' slaves:
+// every unit id of the listener maps to a slave of a channel, so that engineering tools share
+// the bus with the poller instead of opening a connection of their own
+type Passthrough struct {
+	Listen string            `json:"listen,omitempty"`
+	Units  []PassthroughUnit `json:"units,omitempty"`
+}
+type PassthroughUnit struct {
+	UnitId  uint8  `json:"unit_id"`
+	Channel string `json:"channel"`
+	SlaveId uint8  `json:"slave_id"`
+}
+
+func (p Passthrough) GetListen() string {
+	if p.Listen == "" {
+		return defaultPassthroughListen
+	}
+	return p.Listen
+}
+
+// validate checks that units are unique & map to existing channels
+func (p Passthrough) validate(config *Config) error {
+	units := make(map[uint8]bool)
+	for _, u := range p.Units {
+		if units[u.UnitId] {
+			return fmt.Errorf("unit %d is mapped more than once", u.UnitId)
+		}
+		units[u.UnitId] = true
+		if _, err := config.FindChannelByTitle(u.Channel); err != nil {
+			return fmt.Errorf("unit %d: %w", u.UnitId, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"fmt"
+	"github.com/xhit/go-str2duration/v2"
+	"time"
+)
+
+const (
+	PollClassFast   = "fast"
+	PollClassNormal = "normal"
+	PollClassSlow   = "slow"
+	// PollClassOnce registers are read once after the poller starts
+	PollClassOnce = "once"
+)
+
+var defaultPollClasses = map[string]time.Duration{
+	PollClassFast:   time.Millisecond * 200,
+	PollClassNormal: time.Second,
+	PollClassSlow:   time.Minute,
+}
+
+// PollSettings is the poll rate of a register or of a device's registers by default;
+// an explicit interval takes precedence over a poll class
+type PollSettings struct {
+	PollInterval *string `json:"poll_interval,omitempty"`
+	PollClass    string  `json:"poll_class,omitempty"`
+}
+
+func (s PollSettings) isSet() bool {
+	return s.PollInterval != nil || s.PollClass != ""
+}
+func parsePollSettings(obj map[string]interface{}) PollSettings {
+	var result PollSettings
+	if nil != obj["poll_interval"] {
+		v := fmt.Sprint(obj["poll_interval"])
+		result.PollInterval = &v
+	}
+	if nil != obj["poll_class"] {
+		result.PollClass = fmt.Sprint(obj["poll_class"])
+	}
+	return result
+}
+
+// GetMetricTTL returns how long a register's value stays in the cache: the cache's TTL, but at least
+// two poll intervals, so that values of slowly polled registers do not expire between polls;
+// values of registers read once do not expire
+func (config *Config) GetMetricTTL(register *Register) (ttl time.Duration, expires bool) {
+	interval, once, err := config.GetPollInterval(register)
+	if err == nil && once {
+		return 0, false
+	}
+	return max(config.GetTTL(), 2*interval), true
+}
+
+// GetPollInterval resolves register's poll interval from its own settings, falling back
+// to its device's settings and then to the 'normal' poll class; once is set for registers
+// which are to be read only once
+func (config *Config) GetPollInterval(register *Register) (interval time.Duration, once bool, err error) {
+	settings := register.PollSettings
+	if !settings.isSet() && register.Device != nil {
+		settings = register.Device.PollSettings
+	}
+	if settings.PollInterval != nil {
+		v, err := str2duration.ParseDuration(*settings.PollInterval)
+		if err != nil {
+			return 0, false, fmt.Errorf("register '%s': invalid poll interval '%s'", register.Title, *settings.PollInterval)
+		}
+		if v <= 0 {
+			return 0, false, fmt.Errorf("register '%s': poll interval must be positive", register.Title)
+		}
+		return v, false, nil
+	}
+	class := settings.PollClass
+	if class == "" {
+		class = PollClassNormal
+	}
+	if class == PollClassOnce {
+		return 0, true, nil
+	}
+	if v, ok := config.PollClasses[class]; ok {
+		d, err := str2duration.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, false, fmt.Errorf("poll class '%s': invalid interval '%s'", class, v)
+		}
+		return d, false, nil
+	}
+	if v, ok := defaultPollClasses[class]; ok {
+		return v, false, nil
+	}
+	return 0, false, fmt.Errorf("register '%s': unknown poll class '%s'", register.Title, class)
+}
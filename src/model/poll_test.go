@@ -0,0 +1,78 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetPollInterval(t *testing.T) {
+	data := []byte(`{"poll_classes": {"slow": "1h"}, "channels": [{"title": "c", "devices": [
+		{"title": "d", "poll_class": "slow", "registers": [
+			{"title": "motion", "type": "input", "poll_interval": "200ms"},
+			{"title": "serial", "type": "input", "poll_class": "once"},
+			{"title": "fast", "type": "input", "poll_class": "fast"},
+			{"title": "status", "type": "input"}]},
+		{"title": "e", "registers": [{"title": "status", "type": "input"}]}]}]}`)
+	config, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	tests := []struct {
+		reference string
+		interval  time.Duration
+		once      bool
+	}{
+		{"c:d:motion", time.Millisecond * 200, false},
+		{"c:d:serial", 0, true},
+		{"c:d:fast", time.Millisecond * 200, false},
+		{"c:d:status", time.Hour, false},
+		{"c:e:status", time.Second, false},
+	}
+	for _, test := range tests {
+		r, err := config.FindRegister(test.reference)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		interval, once, err := config.GetPollInterval(r)
+		if err != nil {
+			t.Fatalf("%s: %s", test.reference, err)
+		}
+		if test.interval != interval || test.once != once {
+			t.Errorf("%s: expected %s (once: %t), got %s (once: %t) instead", test.reference, test.interval, test.once, interval, once)
+		}
+	}
+}
+func TestValidateUnknownPollClass(t *testing.T) {
+	data := []byte(`{"channels": [{"title": "c", "devices": [{"title": "d", "registers": [{"title": "r", "poll_class": "hourly"}]}]}]}`)
+	if _, err := ParseConfig(data); err == nil {
+		t.Errorf("expected error for unknown poll class")
+	}
+}
+func TestGetMetricTTL(t *testing.T) {
+	data := []byte(`{"ttl": "30s", "channels": [{"title": "c", "devices": [{"title": "d", "registers": [
+		{"title": "serial", "poll_class": "once"},
+		{"title": "energy", "poll_class": "slow"},
+		{"title": "status"}]}]}]}`)
+	config, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	tests := []struct {
+		reference string
+		ttl       time.Duration
+		expires   bool
+	}{
+		{"c:d:serial", 0, false},
+		{"c:d:energy", 2 * time.Minute, true},
+		{"c:d:status", 30 * time.Second, true},
+	}
+	for _, test := range tests {
+		r, err := config.FindRegister(test.reference)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if ttl, expires := config.GetMetricTTL(r); ttl != test.ttl || expires != test.expires {
+			t.Errorf("%s: expected %s (expires: %t), got %s (expires: %t)", test.reference, test.ttl, test.expires, ttl, expires)
+		}
+	}
+}
@@ -3,21 +3,78 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 )
 
 type Register struct {
-	Device  *Device `json:"-"`
-	Type    RegType `json:"type,string,omitempty"`
-	Mode    RegMode `json:"mode,string,omitempty"`
-	Title   string  `json:"title,omitempty"`
-	Address uint16  `json:"address,omitempty"`
-	Size    uint16  `json:"size,omitempty"`
-	Factor  float32 `json:"factor,omitempty"`
+	Device    *Device            `json:"-"`
+	Type      RegType            `json:"type,string,omitempty"`
+	Mode      RegMode            `json:"mode,string,omitempty"`
+	Title     string             `json:"title,omitempty"`
+	Address   uint16             `json:"address,omitempty"`
+	Size      uint16             `json:"size,omitempty"`
+	Factor    float64            `json:"factor,omitempty"`
+	DataType  DataType           `json:"data_type,omitempty"`
+	ByteOrder ByteOrder          `json:"byte_order,omitempty"`
+	SwapBytes bool               `json:"swap_bytes,omitempty"`
+	Trim      bool               `json:"trim,omitempty"`
+	Bits      []BitField         `json:"bits,omitempty"`
+	Variables map[string]float64 `json:"variables,omitempty"`
+	Transform *Expression        `json:"transform,omitempty"`
+	Inverse   *Expression        `json:"inverse_transform,omitempty"`
+	Sim       *Simulation        `json:"sim,omitempty"`
+	PollSettings
 }
 
 func (r Register) String() string {
-	return fmt.Sprintf("type: %s, mode: %s, addr: %d, size: %d", r.Type, r.Mode, r.Address, r.Size)
+	return fmt.Sprintf("type: %s, mode: %s, addr: %d, size: %d, data: %s/%s",
+		r.Type, r.Mode, r.Address, r.Size, r.DataType, r.ByteOrder)
+}
+
+// IsBit reports whether the register holds single-bit (coil or discrete input) data
+func (r Register) IsBit() bool {
+	return r.Type == COIL || r.Type == DISCRETE
+}
+
+// IsInteger reports whether the register holds an integer value, i.e. one bit fields can be taken from
+func (r Register) IsInteger() bool {
+	switch r.DataType {
+	case INT16, UINT16, INT32, UINT32, INT64, UINT64:
+		return true
+	default:
+		return false
+	}
+}
+
+// ToValue converts a raw register value into engineering value using the register's
+// transform expression, or multiplying by the register's factor if there is none
+func (r *Register) ToValue(raw float64) (float64, error) {
+	if r.Transform == nil {
+		return r.Factor * raw, nil
+	}
+	return r.Transform.Evaluate(raw, 0, r.Factor, r.Variables)
+}
+
+// ToRaw converts an engineering value into raw register value using the register's
+// inverse transform expression, or dividing by the register's factor if there is none
+func (r *Register) ToRaw(value float64) (float64, error) {
+	if r.Inverse == nil {
+		if r.Factor == 0 {
+			return math.NaN(), fmt.Errorf("register '%s': zero factor", r.Title)
+		}
+		return value / r.Factor, nil
+	}
+	return r.Inverse.Evaluate(0, value, r.Factor, r.Variables)
+}
+
+func (r *Register) findBitFieldByTitle(title string) (*BitField, error) {
+	for _, v := range r.Bits {
+		if v.Title == title {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("no bit field found for title '%s'", title)
 }
 
 // UnmarshalJSON custom deserializer to apply default values in case of empty fields
@@ -47,19 +104,97 @@ func (r *Register) UnmarshalJSON(data []byte) (err error) {
 	if nil != obj["title"] {
 		register.Title = fmt.Sprint(obj["title"])
 	}
+	if nil != obj["data_type"] {
+		if register.DataType, err = parseDataType(fmt.Sprint(obj["data_type"])); err != nil {
+			return err
+		}
+	}
+	if nil != obj["byte_order"] {
+		if register.ByteOrder, err = parseByteOrder(fmt.Sprint(obj["byte_order"])); err != nil {
+			return err
+		}
+	} else {
+		register.ByteOrder = ABCD
+	}
+	if nil != obj["swap_bytes"] {
+		register.SwapBytes, _ = strconv.ParseBool(fmt.Sprint(obj["swap_bytes"]))
+	}
+	if nil != obj["trim"] {
+		register.Trim, _ = strconv.ParseBool(fmt.Sprint(obj["trim"]))
+	} else {
+		register.Trim = true
+	}
 	if nil != obj["size"] {
 		v, _ := strconv.Atoi(fmt.Sprint(obj["size"]))
 		register.Size = uint16(v)
+	} else if register.DataType == STRING {
+		return fmt.Errorf("register '%s': size (in registers) is required for string data", register.Title)
+	} else if register.DataType != 0 {
+		register.Size = register.DataType.Words()
 	} else {
 		register.Size = 1
 	}
+	if register.DataType == 0 {
+		// keep configurations without data type working: a two-word register is an unsigned 32-bit value
+		if register.Size == 2 {
+			register.DataType = UINT32
+		} else {
+			register.DataType = UINT16
+		}
+	}
+	if !register.IsBit() && register.Size < register.DataType.Words() {
+		return fmt.Errorf("register '%s': size %d is too small for %s data", register.Title, register.Size, register.DataType)
+	}
+	if nil != obj["variables"] {
+		b, err := json.Marshal(obj["variables"])
+		if nil != err {
+			return err
+		}
+		if err := json.Unmarshal(b, &register.Variables); err != nil {
+			return fmt.Errorf("register '%s': variables must be numbers: %w", register.Title, err)
+		}
+	}
+	if nil != obj["transform"] {
+		if register.Transform, err = CompileExpression(fmt.Sprint(obj["transform"]), register.Variables); err != nil {
+			return fmt.Errorf("register '%s': %w", register.Title, err)
+		}
+	}
+	if nil != obj["inverse_transform"] {
+		if register.Inverse, err = CompileExpression(fmt.Sprint(obj["inverse_transform"]), register.Variables); err != nil {
+			return fmt.Errorf("register '%s': %w", register.Title, err)
+		}
+	} else if register.Transform != nil && (register.Mode == RW || register.Mode == WO) {
+		return fmt.Errorf("register '%s': writable register with transform requires inverse_transform", register.Title)
+	}
+	if nil != obj["bits"] {
+		if register.IsBit() || !register.IsInteger() {
+			return fmt.Errorf("register '%s': bit fields require an integer register", register.Title)
+		}
+		b, err := json.Marshal(obj["bits"])
+		if nil != err {
+			return err
+		}
+		if err := json.Unmarshal(b, &register.Bits); err != nil {
+			return err
+		}
+	}
+	if nil != obj["sim"] {
+		b, err := json.Marshal(obj["sim"])
+		if nil != err {
+			return err
+		}
+		if err := json.Unmarshal(b, &register.Sim); err != nil {
+			return fmt.Errorf("register '%s': %w", register.Title, err)
+		}
+	}
+	register.PollSettings = parsePollSettings(obj)
 	if nil != obj["factor"] {
-		v, _ := strconv.ParseFloat(fmt.Sprint(obj["factor"]), 32)
+		v, err := strconv.ParseFloat(fmt.Sprint(obj["factor"]), 64)
 		if err != nil {
 			//log.Fatalf("%q\n", err)
 			v = 1.0
 		}
-		register.Factor = float32(v)
+		register.Factor = v
 	} else {
 		register.Factor = 1.0
 	}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"fmt"
+	"github.com/xhit/go-str2duration/v2"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	serialBaudRates = []int{1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200, 230400, 460800, 921600}
+	serialParities  = map[string]string{
+		"n": "N", "none": "N",
+		"e": "E", "even": "E",
+		"o": "O", "odd": "O",
+	}
+)
+
+// Serial is the line configuration of a serial channel; unset values are the Modbus
+// defaults of 19200 baud, 8 data bits, even parity and 1 stop bit
+type Serial struct {
+	Baud     int    `json:"baud,omitempty"`
+	DataBits int    `json:"data_bits,omitempty"`
+	Parity   string `json:"parity,omitempty"`
+	StopBits int    `json:"stop_bits,omitempty"`
+	RS485    *RS485 `json:"rs485,omitempty"`
+}
+
+// RS485 configures the driver's RTS control for half-duplex RS-485 transceivers
+type RS485 struct {
+	Enabled            bool    `json:"enabled,omitempty"`
+	DelayRtsBeforeSend *string `json:"delay_rts_before_send,omitempty"`
+	DelayRtsAfterSend  *string `json:"delay_rts_after_send,omitempty"`
+	RtsHighDuringSend  bool    `json:"rts_high_during_send,omitempty"`
+	RtsHighAfterSend   bool    `json:"rts_high_after_send,omitempty"`
+	RxDuringTx         bool    `json:"rx_during_tx,omitempty"`
+}
+
+func (s Serial) GetBaud() int {
+	if s.Baud == 0 {
+		return 19200
+	}
+	return s.Baud
+}
+func (s Serial) GetDataBits() int {
+	if s.DataBits == 0 {
+		return 8
+	}
+	return s.DataBits
+}
+
+// GetParity returns parity as one of 'N', 'E' or 'O'
+func (s Serial) GetParity() string {
+	if s.Parity == "" {
+		return "E"
+	}
+	return serialParities[strings.ToLower(s.Parity)]
+}
+func (s Serial) GetStopBits() int {
+	if s.StopBits == 0 {
+		return 1
+	}
+	return s.StopBits
+}
+func (s Serial) String() string {
+	return fmt.Sprintf("%d %d%s%d", s.GetBaud(), s.GetDataBits(), s.GetParity(), s.GetStopBits())
+}
+
+func (r RS485) GetDelayRtsBeforeSend() time.Duration {
+	return durationOrDefault(r.DelayRtsBeforeSend, 0)
+}
+func (r RS485) GetDelayRtsAfterSend() time.Duration {
+	return durationOrDefault(r.DelayRtsAfterSend, 0)
+}
+
+// validate checks the line settings for the channel's mode: RTU frames
+// are made of 8 bit characters, while ASCII ones may use 7 bits
+func (s Serial) validate(mode Mode) error {
+	if !slices.Contains(serialBaudRates, s.GetBaud()) {
+		return fmt.Errorf("unsupported baud rate %d", s.Baud)
+	}
+	if _, ok := serialParities[strings.ToLower(s.Parity)]; s.Parity != "" && !ok {
+		return fmt.Errorf("unsupported parity '%s'", s.Parity)
+	}
+	if s.GetStopBits() != 1 && s.GetStopBits() != 2 {
+		return fmt.Errorf("unsupported stop bits %d", s.StopBits)
+	}
+	if s.GetDataBits() != 8 && (mode != ASCII || s.GetDataBits() != 7) {
+		return fmt.Errorf("unsupported data bits %d for %s mode", s.DataBits, mode)
+	}
+	if nil != s.RS485 {
+		for _, v := range []*string{s.RS485.DelayRtsBeforeSend, s.RS485.DelayRtsAfterSend} {
+			if v == nil {
+				continue
+			}
+			if d, err := str2duration.ParseDuration(*v); err != nil || d < 0 {
+				return fmt.Errorf("invalid rs485 delay '%s'", *v)
+			}
+		}
+	}
+	return nil
+}
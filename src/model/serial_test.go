@@ -0,0 +1,27 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestSerialDefaults(t *testing.T) {
+	if v := (Serial{}).String(); "19200 8E1" != v {
+		t.Errorf("expected '19200 8E1', got '%s' instead", v)
+	}
+	if v := (Serial{Baud: 9600, Parity: "none", StopBits: 2}).String(); "9600 8N2" != v {
+		t.Errorf("expected '9600 8N2', got '%s' instead", v)
+	}
+}
+func TestSerialValidate(t *testing.T) {
+	testValidity(t, `{"channels": [%s]}`, []validityTest{
+		{`{"title": "c", "mode": "rtu", "serial": {"baud": 9600, "parity": "N", "stop_bits": 2}}`, true},
+		{`{"title": "c", "mode": "rtu", "serial": {"rs485": {"enabled": true, "delay_rts_before_send": "1ms"}}}`, true},
+		{`{"title": "c", "mode": "rtu", "serial": {"baud": 9601}}`, false},
+		{`{"title": "c", "mode": "rtu", "serial": {"parity": "mark"}}`, false},
+		{`{"title": "c", "mode": "rtu", "serial": {"stop_bits": 3}}`, false},
+		{`{"title": "c", "mode": "rtu", "serial": {"data_bits": 7}}`, false},
+		{`{"title": "c", "mode": "ascii", "serial": {"data_bits": 7}}`, true},
+		{`{"title": "c", "mode": "rtu", "serial": {"rs485": {"delay_rts_after_send": "later"}}}`, false},
+		{`{"title": "c", "mode": "tcp", "serial": {"baud": 9600}}`, false},
+	})
+}
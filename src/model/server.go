@@ -0,0 +1,55 @@
+package model
+
+import "fmt"
+
+const defaultServerListen = ":502"
+
+// ModbusServer configures the Modbus TCP server exposing cached register values: every unit
+// maps registers of the bridge to virtual addresses of the register's table
+type ModbusServer struct {
+	Listen string       `json:"listen,omitempty"`
+	Units  []ServerUnit `json:"units,omitempty"`
+}
+type ServerUnit struct {
+	UnitId    uint8            `json:"unit_id"`
+	Registers []ServerRegister `json:"registers,omitempty"`
+}
+type ServerRegister struct {
+	Reference string `json:"reference"`
+	Address   uint16 `json:"address"`
+}
+
+func (s ModbusServer) GetListen() string {
+	if s.Listen == "" {
+		return defaultServerListen
+	}
+	return s.Listen
+}
+
+// validate checks that mapped registers exist & do not overlap within unit's tables
+func (s ModbusServer) validate(config *Config) error {
+	for _, u := range s.Units {
+		type span struct {
+			reference  string
+			start, end int
+		}
+		spans := make(map[RegType][]span)
+		for _, r := range u.Registers {
+			register, err := config.FindRegister(r.Reference)
+			if err != nil {
+				return fmt.Errorf("unit %d: %w", u.UnitId, err)
+			}
+			current := span{r.Reference, int(r.Address), int(r.Address) + int(register.Size)}
+			if current.end > 0x10000 {
+				return fmt.Errorf("unit %d: %s does not fit address space at %d", u.UnitId, r.Reference, r.Address)
+			}
+			for _, other := range spans[register.Type] {
+				if current.start < other.end && other.start < current.end {
+					return fmt.Errorf("unit %d: %s overlaps %s", u.UnitId, r.Reference, other.reference)
+				}
+			}
+			spans[register.Type] = append(spans[register.Type], current)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestModbusServerValidate(t *testing.T) {
+	layout := `{"channels": [{"title": "c", "devices": [{"title": "d", "registers": [
+		{"title": "a", "type": "holding", "data_type": "float32"},
+		{"title": "b", "type": "holding"},
+		{"title": "c", "type": "input"}]}]}],
+		"modbus_server": {"units": [{"unit_id": 1, "registers": [%s]}]}}`
+	testValidity(t, layout, []validityTest{
+		{`{"reference": "c:d:a", "address": 0}, {"reference": "c:d:b", "address": 2}, {"reference": "c:d:c", "address": 0}`, true},
+		{`{"reference": "c:d:a", "address": 0}, {"reference": "c:d:b", "address": 1}`, false},
+		{`{"reference": "c:d:a", "address": 65535}`, false},
+		{`{"reference": "c:d:x", "address": 0}`, false},
+	})
+}
+
+func TestPassthroughValidate(t *testing.T) {
+	testValidity(t, `{"channels": [{"title": "c"}], "passthrough": {"units": [%s]}}`, []validityTest{
+		{`{"unit_id": 1, "channel": "c", "slave_id": 1}, {"unit_id": 2, "channel": "c", "slave_id": 7}`, true},
+		{`{"unit_id": 1, "channel": "c", "slave_id": 1}, {"unit_id": 1, "channel": "c", "slave_id": 7}`, false},
+		{`{"unit_id": 1, "channel": "x", "slave_id": 1}`, false},
+	})
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xhit/go-str2duration/v2"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSimulationMax    = 100
+	defaultSimulationPeriod = time.Minute
+)
+
+// Simulation seeds the raw value of a register of a sim channel:
+//   - constant holds value;
+//   - ramp rises from min to max over the period, then starts over;
+//   - sine oscillates between min and max with the period;
+//   - random_walk starts at value & moves by up to step at every read, staying within min and max;
+//   - toggle switches between min and max every period.
+type Simulation struct {
+	Generator Generator     `json:"generator,omitempty"`
+	Value     float64       `json:"value,omitempty"`
+	Min       float64       `json:"min,omitempty"`
+	Max       float64       `json:"max,omitempty"`
+	Step      float64       `json:"step,omitempty"`
+	Period    time.Duration `json:"period,omitempty"`
+}
+
+// UnmarshalJSON custom deserializer to apply default values in case of empty fields
+func (s *Simulation) UnmarshalJSON(data []byte) (err error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	simulation := Simulation{
+		Generator: CONSTANT,
+		Max:       defaultSimulationMax,
+		Period:    defaultSimulationPeriod,
+	}
+
+	if nil != obj["generator"] {
+		if simulation.Generator, err = parseGenerator(fmt.Sprint(obj["generator"])); err != nil {
+			return err
+		}
+	}
+	for key, field := range map[string]*float64{"value": &simulation.Value, "min": &simulation.Min, "max": &simulation.Max, "step": &simulation.Step} {
+		if nil != obj[key] {
+			if *field, err = strconv.ParseFloat(fmt.Sprint(obj[key]), 64); err != nil {
+				return fmt.Errorf("simulation: invalid %s '%v'", key, obj[key])
+			}
+		}
+	}
+	if simulation.Min > simulation.Max {
+		return fmt.Errorf("simulation: min %v is greater than max %v", simulation.Min, simulation.Max)
+	}
+	if nil == obj["value"] && simulation.Generator == RANDOM_WALK {
+		simulation.Value = (simulation.Min + simulation.Max) / 2
+	}
+	if nil == obj["step"] {
+		simulation.Step = (simulation.Max - simulation.Min) / 100
+	}
+	if nil != obj["period"] {
+		simulation.Period, err = str2duration.ParseDuration(fmt.Sprint(obj["period"]))
+		if err != nil || simulation.Period <= 0 {
+			return fmt.Errorf("simulation: invalid period '%v'", obj["period"])
+		}
+	}
+	*s = simulation
+	return nil
+}
+
+// At returns the value of a generator not depending on the previous one, elapsed time after the start
+func (s Simulation) At(elapsed time.Duration) float64 {
+	phase := float64(elapsed%s.Period) / float64(s.Period)
+	switch s.Generator {
+	case RAMP:
+		return s.Min + (s.Max-s.Min)*phase
+	case SINE:
+		return s.Min + (s.Max-s.Min)*(1+math.Sin(2*math.Pi*phase))/2
+	case TOGGLE:
+		if (elapsed/s.Period)%2 == 0 {
+			return s.Min
+		}
+		return s.Max
+	default:
+		return s.Value
+	}
+}
+
+// Walk returns the next value of a random walk, moving the previous one by the fraction (-1..1) of the step
+func (s Simulation) Walk(previous, fraction float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, previous+fraction*s.Step))
+}
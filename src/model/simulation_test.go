@@ -0,0 +1,55 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSimulationGenerators(t *testing.T) {
+	tests := []struct {
+		sim      string
+		elapsed  time.Duration
+		expected float64
+	}{
+		{`{}`, time.Hour, 0},
+		{`{"value": 21.5}`, time.Hour, 21.5},
+		{`{"generator": "ramp", "min": 10, "max": 20, "period": "10s"}`, 15 * time.Second, 15},
+		{`{"generator": "sine", "min": 0, "max": 10, "period": "4s"}`, 5 * time.Second, 10},
+		{`{"generator": "sine", "min": 0, "max": 10, "period": "4s"}`, 3 * time.Second, 0},
+		{`{"generator": "toggle", "max": 1, "period": "1s"}`, 500 * time.Millisecond, 0},
+		{`{"generator": "toggle", "max": 1, "period": "1s"}`, 1500 * time.Millisecond, 1},
+	}
+	for _, test := range tests {
+		var sim Simulation
+		if err := json.Unmarshal([]byte(test.sim), &sim); err != nil {
+			t.Fatalf("%s: %s", test.sim, err)
+		}
+		if v := sim.At(test.elapsed); v < test.expected-1e-9 || v > test.expected+1e-9 {
+			t.Errorf("%s: expected %v after %s, got %v instead", test.sim, test.expected, test.elapsed, v)
+		}
+	}
+}
+func TestSimulationRandomWalk(t *testing.T) {
+	var sim Simulation
+	if err := json.Unmarshal([]byte(`{"generator": "random_walk", "min": 0, "max": 10, "step": 2}`), &sim); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if 5 != sim.Value {
+		t.Errorf("expected walk to start in the middle of the range, got %v instead", sim.Value)
+	}
+	if v := sim.Walk(9, 1); 10 != v {
+		t.Errorf("expected walk to stay within max, got %v instead", v)
+	}
+	if v := sim.Walk(5, -0.5); 4 != v {
+		t.Errorf("expected walk by half a step down, got %v instead", v)
+	}
+}
+func TestSimulationInvalid(t *testing.T) {
+	for _, data := range []string{`{"generator": "square"}`, `{"min": 10, "max": 0}`, `{"period": "0s"}`, `{"min": "a"}`} {
+		var sim Simulation
+		if err := json.Unmarshal([]byte(data), &sim); err == nil {
+			t.Errorf("%s: expected error", data)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"github.com/xhit/go-str2duration/v2"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetries         = 0
+	defaultRetryDelay      = time.Millisecond * 100
+	defaultTurnaroundDelay = 0
+)
+
+// Timing is the bus timing of a channel or of one of its devices; unset device settings
+// fall back to the channel's ones, unset timeouts to the defaults of channel's mode
+type Timing struct {
+	Timeout         *string `json:"timeout,omitempty"`
+	IdleTimeout     *string `json:"idle_timeout,omitempty"`
+	Retries         *int    `json:"retries,omitempty"`
+	RetryDelay      *string `json:"retry_delay,omitempty"`
+	TurnaroundDelay *string `json:"turnaround_delay,omitempty"`
+}
+
+func parseTiming(obj map[string]interface{}) Timing {
+	var result Timing
+	for key, field := range map[string]**string{
+		"timeout":          &result.Timeout,
+		"idle_timeout":     &result.IdleTimeout,
+		"retry_delay":      &result.RetryDelay,
+		"turnaround_delay": &result.TurnaroundDelay,
+	} {
+		if nil != obj[key] {
+			v := fmt.Sprint(obj[key])
+			*field = &v
+		}
+	}
+	if nil != obj["retries"] {
+		v, _ := strconv.Atoi(fmt.Sprint(obj["retries"]))
+		result.Retries = &v
+	}
+	return result
+}
+
+// validate checks that durations parse and are not negative
+func (t Timing) validate() error {
+	for key, value := range map[string]*string{
+		"timeout":          t.Timeout,
+		"idle_timeout":     t.IdleTimeout,
+		"retry_delay":      t.RetryDelay,
+		"turnaround_delay": t.TurnaroundDelay,
+	} {
+		if value == nil {
+			continue
+		}
+		if v, err := str2duration.ParseDuration(*value); err != nil || v < 0 {
+			return fmt.Errorf("invalid %s '%s'", key, *value)
+		}
+	}
+	if t.Retries != nil && *t.Retries < 0 {
+		return fmt.Errorf("invalid retries '%d'", *t.Retries)
+	}
+	return nil
+}
+
+// GetTimeout returns how long to wait for the device's answer; zero means the handler's default
+func (d *Device) GetTimeout() time.Duration {
+	return durationOrDefault(d.Timing.Timeout, durationOrDefault(d.Channel.Timeout, 0))
+}
+
+// GetRetries returns how many times a command failing for lack of answer is repeated
+func (d *Device) GetRetries() int {
+	if d.Timing.Retries != nil {
+		return *d.Timing.Retries
+	}
+	return intOrDefault(d.Channel.Retries, defaultRetries)
+}
+
+// GetRetryDelay returns the pause before repeating a failed command
+func (d *Device) GetRetryDelay() time.Duration {
+	return durationOrDefault(d.Timing.RetryDelay, durationOrDefault(d.Channel.RetryDelay, defaultRetryDelay))
+}
+
+// GetTurnaroundDelay returns the pause after a write, before the next command is sent to the bus
+func (d *Device) GetTurnaroundDelay() time.Duration {
+	return durationOrDefault(d.Timing.TurnaroundDelay, durationOrDefault(d.Channel.TurnaroundDelay, defaultTurnaroundDelay))
+}
+
+// GetTimeout returns channel's response timeout; zero means the handler's default
+func (c Channel) GetTimeout() time.Duration {
+	return durationOrDefault(c.Timeout, 0)
+}
+
+// GetIdleTimeout returns how long an unused connection is kept open; zero means the handler's default
+func (c Channel) GetIdleTimeout() time.Duration {
+	return durationOrDefault(c.IdleTimeout, 0)
+}
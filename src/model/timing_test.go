@@ -0,0 +1,50 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimingOverrides(t *testing.T) {
+	var channel Channel
+	data := `{"title": "c", "timeout": "3s", "retries": 2, "turnaround_delay": "50ms", "devices": [
+		{"title": "slow", "timeout": "5s", "retries": 0, "retry_delay": "1s"},
+		{"title": "default"}]}`
+	if err := json.Unmarshal([]byte(data), &channel); err != nil {
+		t.Fatalf("%s", err)
+	}
+	slow, other := &channel.Devices[0], &channel.Devices[1]
+	slow.Channel, other.Channel = &channel, &channel
+
+	if v := slow.GetTimeout(); 5*time.Second != v {
+		t.Errorf("expected device timeout '5s', got '%v' instead", v)
+	}
+	if v := other.GetTimeout(); 3*time.Second != v {
+		t.Errorf("expected channel timeout '3s', got '%v' instead", v)
+	}
+	if v := slow.GetRetries(); 0 != v {
+		t.Errorf("expected device retries '0', got '%d' instead", v)
+	}
+	if v := other.GetRetries(); 2 != v {
+		t.Errorf("expected channel retries '2', got '%d' instead", v)
+	}
+	if v := slow.GetRetryDelay(); time.Second != v {
+		t.Errorf("expected device retry delay '1s', got '%v' instead", v)
+	}
+	if v := other.GetRetryDelay(); defaultRetryDelay != v {
+		t.Errorf("expected default retry delay, got '%v' instead", v)
+	}
+	if v := other.GetTurnaroundDelay(); 50*time.Millisecond != v {
+		t.Errorf("expected channel turnaround delay '50ms', got '%v' instead", v)
+	}
+	if v := channel.GetIdleTimeout(); 0 != v {
+		t.Errorf("expected no idle timeout, got '%v' instead", v)
+	}
+}
+func TestTimingValidate(t *testing.T) {
+	data := `{"channels": [{"title": "c", "devices": [{"title": "d", "retry_delay": "soon"}]}]}`
+	if _, err := ParseConfig([]byte(data)); err == nil {
+		t.Error("expected invalid retry delay to be reported")
+	}
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSSettings is the security configuration of a Modbus/TCP Security channel: the client certificate
+// and key (the certificate carries the client's role), the CA verifying the server's
+// certificate and the name the server's certificate is issued to
+type TLSSettings struct {
+	Cert       string `json:"cert,omitempty"`
+	Key        string `json:"key,omitempty"`
+	CA         string `json:"ca,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+}
+
+// Load reads certificates & builds client configuration for mutual authentication, TLS 1.2 at least
+func (t TLSSettings) Load() (*tls.Config, error) {
+	if t.Cert == "" || t.Key == "" {
+		return nil, errors.New("client certificate and key are required")
+	}
+	cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+	if err != nil {
+		return nil, fmt.Errorf("could not load client certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   t.ServerName,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file '%s'", t.CA)
+		}
+	}
+	return config, nil
+}
+
+// validateTLS checks that security settings are given for TLS channels only & can be loaded
+func (c Channel) validateTLS() error {
+	if c.Mode != TLS {
+		if c.TLS != nil {
+			return fmt.Errorf("tls settings can not be used in %s mode", c.Mode)
+		}
+		return nil
+	}
+	if c.TLS == nil {
+		return errors.New("tls settings are required in tls mode")
+	}
+	if _, err := c.TLS.Load(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestTLSValidate(t *testing.T) {
+	testValidity(t, `{"channels": [%s]}`, []validityTest{
+		{`{"title": "c", "mode": "tcp"}`, true},
+		{`{"title": "c", "mode": "tls"}`, false},
+		{`{"title": "c", "mode": "tls", "tls": {"ca": "ca.crt"}}`, false},
+		{`{"title": "c", "mode": "tls", "tls": {"cert": "missing.crt", "key": "missing.key"}}`, false},
+		{`{"title": "c", "mode": "tcp", "tls": {"cert": "client.crt", "key": "client.key"}}`, false},
+	})
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Trigger is the condition on a metric's value a webhook is called on
+type Trigger uint8
+
+const (
+	CHANGE Trigger = iota + 1
+	THRESHOLD
+	STATE
+)
+
+var (
+	triggerName = map[uint8]string{
+		1: "change",
+		2: "threshold",
+		3: "state",
+	}
+	triggerValue = map[string]uint8{
+		"change":    1,
+		"threshold": 2,
+		"state":     3,
+	}
+)
+
+func parseTrigger(s string) (Trigger, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	value, ok := triggerValue[s]
+	if !ok {
+		return Trigger(0), fmt.Errorf("%q is not a valid trigger", s)
+	}
+	return Trigger(value), nil
+}
+func (t Trigger) String() string {
+	return triggerName[uint8(t)]
+}
+func (t Trigger) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+func (t *Trigger) UnmarshalJSON(data []byte) (err error) {
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	if *t, err = parseTrigger(input); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	defaultWebhookQueue      = "webhooks.queue"
+	defaultWebhookQueueSize  = 1000
+	defaultWebhookRedeliver  = time.Minute
+	defaultWebhookMethod     = http.MethodPost
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookRetries    = 3
+	defaultWebhookBackoff    = time.Second
+	defaultWebhookMaxBackoff = 30 * time.Second
+)
+
+// Webhooks configures HTTP calls made when metrics meet hooks' conditions: a call failing after its
+// retries is kept in the failure queue file, whose deliveries are retried every redeliver interval
+type Webhooks struct {
+	Queue     string    `json:"queue,omitempty"`
+	QueueSize *int      `json:"queue_size,omitempty"`
+	Redeliver *string   `json:"redeliver,omitempty"`
+	Hooks     []Webhook `json:"hooks,omitempty"`
+}
+
+// Webhook is called with the rendered body when a metric of its references (registers or
+// bit fields, as "register.field") meets the trigger:
+//   - change calls on every change of the raw value;
+//   - threshold calls when the value gets above 'above' or below 'below' & when it gets back,
+//     by more than hysteresis;
+//   - state calls when the value switches between zero (off) and non-zero (on).
+//
+// Bodies are signed with the secret, if it is set.
+type Webhook struct {
+	Title      string            `json:"title"`
+	URL        string            `json:"url"`
+	Method     string            `json:"method,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	Secret     string            `json:"secret,omitempty"`
+	Trigger    Trigger           `json:"trigger,omitempty"`
+	References []string          `json:"references"`
+	Above      *float64          `json:"above,omitempty"`
+	Below      *float64          `json:"below,omitempty"`
+	Hysteresis float64           `json:"hysteresis,omitempty"`
+	Timeout    *string           `json:"timeout,omitempty"`
+	Retries    *int              `json:"retries,omitempty"`
+	Backoff    *string           `json:"backoff,omitempty"`
+	MaxBackoff *string           `json:"max_backoff,omitempty"`
+}
+
+// GetQueue returns the path of the file failed deliveries are kept in
+func (w Webhooks) GetQueue() string {
+	if w.Queue == "" {
+		return defaultWebhookQueue
+	}
+	return w.Queue
+}
+
+// GetQueueSize returns the number of failed deliveries kept, the oldest ones are dropped beyond it
+func (w Webhooks) GetQueueSize() int {
+	return intOrDefault(w.QueueSize, defaultWebhookQueueSize)
+}
+
+// GetRedeliver returns the interval failed deliveries are retried at
+func (w Webhooks) GetRedeliver() time.Duration {
+	return durationOrDefault(w.Redeliver, defaultWebhookRedeliver)
+}
+
+func (w Webhook) GetMethod() string {
+	if w.Method == "" {
+		return defaultWebhookMethod
+	}
+	return w.Method
+}
+func (w Webhook) GetTrigger() Trigger {
+	if w.Trigger == 0 {
+		return CHANGE
+	}
+	return w.Trigger
+}
+
+// GetTimeout returns how long a call waits for the response
+func (w Webhook) GetTimeout() time.Duration {
+	return durationOrDefault(w.Timeout, defaultWebhookTimeout)
+}
+
+// GetRetries returns how many times a failed call is repeated before it goes to the failure queue
+func (w Webhook) GetRetries() int {
+	if w.Retries == nil {
+		return defaultWebhookRetries
+	}
+	return *w.Retries
+}
+
+// GetBackoff returns the initial and the maximum pause between retries of a call
+func (w Webhook) GetBackoff() (initial, maximum time.Duration) {
+	initial = durationOrDefault(w.Backoff, defaultWebhookBackoff)
+	maximum = durationOrDefault(w.MaxBackoff, defaultWebhookMaxBackoff)
+	return initial, max(initial, maximum)
+}
+
+// validate checks that hooks are unique by title, have valid URLs & conditions and refer to existing registers
+// or bit fields
+func (w Webhooks) validate(config *Config) error {
+	var titles []string
+	for _, h := range w.Hooks {
+		if h.Title == "" {
+			return errors.New("title is required")
+		}
+		if slices.Contains(titles, h.Title) {
+			return fmt.Errorf("%s: title is not unique", h.Title)
+		}
+		titles = append(titles, h.Title)
+		if err := h.validate(config); err != nil {
+			return fmt.Errorf("%s: %w", h.Title, err)
+		}
+	}
+	return nil
+}
+func (w Webhook) validate(config *Config) error {
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", w.URL)
+	}
+	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	if !slices.Contains(methods, w.GetMethod()) {
+		return fmt.Errorf("%q is not a valid method", w.Method)
+	}
+	if len(w.References) == 0 {
+		return errors.New("references are required")
+	}
+	for _, reference := range w.References {
+		if _, err := config.FindRegister(reference); err != nil {
+			if _, _, e := config.FindBitField(reference); e != nil {
+				return err
+			}
+		}
+	}
+	if w.GetTrigger() == THRESHOLD {
+		if w.Above == nil && w.Below == nil {
+			return errors.New("threshold requires above or below")
+		}
+		if w.Above != nil && w.Below != nil && *w.Below >= *w.Above {
+			return fmt.Errorf("below %v is not less than above %v", *w.Below, *w.Above)
+		}
+		if w.Hysteresis < 0 {
+			return fmt.Errorf("invalid hysteresis %v", w.Hysteresis)
+		}
+	}
+	if w.Retries != nil && *w.Retries < 0 {
+		return fmt.Errorf("invalid retries '%d'", *w.Retries)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWebhooksValidate(t *testing.T) {
+	layout := `{"channels": [{"title": "c", "devices": [{"title": "d", "registers": [{"title": "r"},
+		{"title": "s", "type": "holding", "bits": [{"title": "alarm", "bit": 3}]}]}]}], "webhooks": {"hooks": %s}}`
+	testValidity(t, layout, []validityTest{
+		{`[{"title": "w", "url": "http://localhost/hook", "references": ["c:d:r"]}]`, true},
+		{`[{"title": "w", "url": "https://localhost/hook", "method": "PUT", "trigger": "threshold", "above": 1200, "hysteresis": 50, "references": ["c:d:r"]}]`, true},
+		{`[{"title": "w", "url": "http://localhost/hook", "trigger": "state", "references": ["c:d:r"]}]`, true},
+		{`[{"url": "http://localhost/hook", "references": ["c:d:r"]}]`, false},
+		{`[{"title": "w", "url": "http://localhost/a", "references": ["c:d:r"]}, {"title": "w", "url": "http://localhost/b", "references": ["c:d:r"]}]`, false},
+		{`[{"title": "w", "url": "localhost/hook", "references": ["c:d:r"]}]`, false},
+		{`[{"title": "w", "url": "http://localhost/hook", "method": "HEAD", "references": ["c:d:r"]}]`, false},
+		{`[{"title": "w", "url": "http://localhost/hook"}]`, false},
+		{`[{"title": "w", "url": "http://localhost/hook", "references": ["c:d:x"]}]`, false},
+		{`[{"title": "w", "url": "http://localhost/hook", "trigger": "state", "references": ["c:d:s.alarm"]}]`, true},
+		{`[{"title": "w", "url": "http://localhost/hook", "references": ["c:d:s.x"]}]`, false},
+		{`[{"title": "w", "url": "http://localhost/hook", "trigger": "threshold", "references": ["c:d:r"]}]`, false},
+		{`[{"title": "w", "url": "http://localhost/hook", "trigger": "threshold", "above": 10, "below": 20, "references": ["c:d:r"]}]`, false},
+		{`[{"title": "w", "url": "http://localhost/hook", "retries": -1, "references": ["c:d:r"]}]`, false},
+	})
+	if err := json.Unmarshal([]byte(`{"title": "w", "trigger": "always"}`), &Webhook{}); err == nil {
+		t.Error("expected invalid trigger to be rejected")
+	}
+
+	var hook Webhook
+	initial, maximum := hook.GetBackoff()
+	if hook.GetMethod() != "POST" || hook.GetTrigger() != CHANGE || hook.GetRetries() != 3 || initial != time.Second || maximum != 30*time.Second {
+		t.Errorf("unexpected defaults: %+v", hook)
+	}
+	var webhooks Webhooks
+	if webhooks.GetQueue() != "webhooks.queue" || webhooks.GetQueueSize() != 1000 || webhooks.GetRedeliver() != time.Minute {
+		t.Errorf("unexpected defaults: %+v", webhooks)
+	}
+}
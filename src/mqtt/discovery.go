@@ -0,0 +1,156 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"math"
+	"mbridge/model"
+	"regexp"
+	"strings"
+)
+
+var unsafeId = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// discoveryConfig is the Home Assistant discovery payload of a register's entity
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueId          string          `json:"unique_id"`
+	ObjectId          string          `json:"object_id"`
+	StateTopic        string          `json:"state_topic,omitempty"`
+	CommandTopic      string          `json:"command_topic,omitempty"`
+	ValueTemplate     string          `json:"value_template,omitempty"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	PayloadOn         string          `json:"payload_on,omitempty"`
+	PayloadOff        string          `json:"payload_off,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	Min               *float64        `json:"min,omitempty"`
+	Max               *float64        `json:"max,omitempty"`
+	Step              float64         `json:"step,omitempty"`
+	Mode              string          `json:"mode,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Model        string   `json:"model,omitempty"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// discoveryMessage is a retained message announcing an entity to Home Assistant
+type discoveryMessage struct {
+	topic   string
+	payload []byte
+}
+
+// discovery builds discovery messages of the registers: writable coils are switches, writable holding
+// registers numbers, other coils & discrete inputs binary sensors, other registers sensors;
+// entities are grouped into Home Assistant devices by channel's device
+func (p *publisherImpl) discovery(registers []*model.Register) []discoveryMessage {
+	var messages []discoveryMessage
+	node := sanitizeId(p.settings.GetClientId())
+	for _, r := range registers {
+		d := r.Device
+		writable := r.Mode == model.RW || r.Mode == model.WO
+		stateTopic := p.Topic(d.Channel.Title, d.Alias, r.Title)
+		entity := discoveryConfig{
+			Name:              r.Title,
+			UniqueId:          sanitizeId(fmt.Sprintf("%s_%s_%s_%s", node, d.Channel.Title, d.Title, r.Title)),
+			ObjectId:          sanitizeId(fmt.Sprintf("%s_%s_%s", d.Channel.Title, d.Alias, r.Title)),
+			StateTopic:        stateTopic,
+			AvailabilityTopic: p.statusTopic(),
+			Device: discoveryDevice{
+				Identifiers:  []string{sanitizeId(fmt.Sprintf("%s_%s_%s", node, d.Channel.Title, d.Title))},
+				Name:         d.Alias,
+				Model:        fmt.Sprintf("Modbus slave %d on %s", d.SlaveId, d.Channel.Title),
+				Manufacturer: "mbridge",
+			},
+		}
+		if r.Mode == model.WO {
+			// nothing is read from write only registers, Home Assistant keeps the state it sets
+			entity.StateTopic = ""
+		}
+		var component string
+		switch {
+		case r.Type == model.COIL && writable:
+			component = "switch"
+			entity.CommandTopic = stateTopic + "/set"
+			entity.PayloadOn, entity.PayloadOff = "1", "0"
+		case r.IsBit():
+			component = "binary_sensor"
+			entity.PayloadOn, entity.PayloadOff = "1", "0"
+		case r.Type == model.HOLDING && writable && r.DataType != model.STRING:
+			component = "number"
+			entity.CommandTopic = stateTopic + "/set"
+			entity.Min, entity.Max, entity.Step = numberRange(r)
+			entity.Mode = "box"
+		default:
+			component = "sensor"
+			if r.DataType != model.STRING {
+				entity.StateClass = "measurement"
+			}
+		}
+		if p.settings.GetPayload() == model.PayloadJSON && entity.StateTopic != "" {
+			switch {
+			case r.DataType == model.STRING:
+				entity.ValueTemplate = "{{ value_json.text }}"
+			case r.IsBit():
+				entity.ValueTemplate = "{{ value_json.value | int }}"
+			default:
+				entity.ValueTemplate = "{{ value_json.value }}"
+			}
+		}
+		payload, err := json.Marshal(entity)
+		if err != nil {
+			p.logger.Warning("could not encode discovery of %s: %v", model.MetricKey(r), err)
+			continue
+		}
+		topic := strings.Join([]string{p.settings.Discovery.GetPrefix(), component, node, entity.ObjectId, "config"}, "/")
+		messages = append(messages, discoveryMessage{topic, payload})
+	}
+	return messages
+}
+
+// numberRange returns engineering value bounds & step of a holding register: the range of its data type
+// scaled by the factor, or unbounded for registers with a transform, whose range is not known
+func numberRange(r *model.Register) (*float64, *float64, float64) {
+	low, high := -math.MaxFloat32, float64(math.MaxFloat32)
+	step := 0.001
+	if r.Transform == nil {
+		switch r.DataType {
+		case model.INT16:
+			low, high = math.MinInt16, math.MaxInt16
+		case model.UINT16:
+			low, high = 0, math.MaxUint16
+		case model.INT32:
+			low, high = math.MinInt32, math.MaxInt32
+		case model.UINT32:
+			low, high = 0, math.MaxUint32
+		}
+		if r.IsInteger() {
+			// rounding drops floating point noise such as 3276.7000000000003 of 32767 * 0.1
+			low, high, step = round(low*r.Factor), round(high*r.Factor), math.Max(math.Abs(r.Factor), step)
+			if low > high {
+				low, high = high, low
+			}
+		}
+	}
+	return &low, &high, step
+}
+
+// round rounds to the step resolution
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+func sanitizeId(id string) string {
+	return strings.ToLower(unsafeId.ReplaceAllString(id, "_"))
+}
+
+// announce publishes discovery messages of all registers, so that Home Assistant creates their entities
+func (p *publisherImpl) announce(client paho.Client) {
+	messages := p.discovery(p.bridge.Regs())
+	for _, message := range messages {
+		client.Publish(message.topic, 1, true, message.payload)
+	}
+	p.logger.Info("announced %d entities to home assistant", len(messages))
+}
@@ -0,0 +1,72 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"mbridge/bridge"
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"strings"
+	"testing"
+)
+
+// configBridge lists configured registers
+type configBridge struct {
+	bridge.Bridge
+	config *model.Config
+}
+
+func (b *configBridge) Regs() []*model.Register {
+	var result []*model.Register
+	for i := range b.config.Channels {
+		for j := range b.config.Channels[i].Devices {
+			for k := range b.config.Channels[i].Devices[j].Registers {
+				result = append(result, &b.config.Channels[i].Devices[j].Registers[k])
+			}
+		}
+	}
+	return result
+}
+
+func TestDiscovery(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "devices": [
+		{"title": "d", "alias": "Boiler Room", "slave_id": 3, "registers": [
+		{"title": "pump", "type": "coil", "mode": "rw"},
+		{"title": "alarm", "type": "discrete"},
+		{"title": "temp", "type": "input", "factor": 0.1},
+		{"title": "setpoint", "type": "holding", "mode": "rw", "data_type": "int16", "factor": 0.1},
+		{"title": "serial", "type": "holding", "mode": "ro", "data_type": "string", "size": 4}]}]}],
+		"mqtt": {"broker": "tcp://localhost:1883", "discovery": {}}}`)
+	publisher := CreatePublisher(config, &configBridge{config: config}).(*publisherImpl)
+	messages := publisher.discovery(publisher.bridge.Regs())
+
+	expected := []struct {
+		topic        string
+		commandTopic string
+		template     string
+	}{
+		{"homeassistant/switch/mbridge/c_boiler_room_pump/config", "mbridge/c/Boiler Room/pump/set", "{{ value_json.value | int }}"},
+		{"homeassistant/binary_sensor/mbridge/c_boiler_room_alarm/config", "", "{{ value_json.value | int }}"},
+		{"homeassistant/sensor/mbridge/c_boiler_room_temp/config", "", "{{ value_json.value }}"},
+		{"homeassistant/number/mbridge/c_boiler_room_setpoint/config", "mbridge/c/Boiler Room/setpoint/set", "{{ value_json.value }}"},
+		{"homeassistant/sensor/mbridge/c_boiler_room_serial/config", "", "{{ value_json.text }}"},
+	}
+	if len(expected) != len(messages) {
+		t.Fatalf("expected %d messages, got %d instead", len(expected), len(messages))
+	}
+	for i, e := range expected {
+		var entity discoveryConfig
+		if err := json.Unmarshal(messages[i].payload, &entity); err != nil {
+			t.Fatalf("%s", err)
+		}
+		if e.topic != messages[i].topic || e.commandTopic != entity.CommandTopic || e.template != entity.ValueTemplate {
+			t.Errorf("expected %s (command: '%s', template: '%s'), got %s (command: '%s', template: '%s') instead",
+				e.topic, e.commandTopic, e.template, messages[i].topic, entity.CommandTopic, entity.ValueTemplate)
+		}
+		if "Boiler Room" != entity.Device.Name || "mbridge_c_d" != entity.Device.Identifiers[0] || "mbridge/status" != entity.AvailabilityTopic {
+			t.Errorf("%s: unexpected device %+v", e.topic, entity.Device)
+		}
+		if strings.HasSuffix(e.topic, "setpoint/config") && (-3276.8 != *entity.Min || 3276.7 != *entity.Max || 0.1 != entity.Step) {
+			t.Errorf("expected scaled int16 range with 0.1 step, got %v..%v by %v", *entity.Min, *entity.Max, entity.Step)
+		}
+	}
+}
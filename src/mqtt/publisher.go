@@ -0,0 +1,221 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"mbridge/bridge"
+	"mbridge/model"
+	"mbridge/util"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize is the number of metrics waiting to be published; further changes of waiting
+	// metrics are coalesced, changes of other metrics dropped
+	queueSize      = 1024
+	connectTimeout = 10 * time.Second
+	statusOnline   = "online"
+	statusOffline  = "offline"
+)
+
+// Publisher is the MQTT sink: it publishes metrics set in channels' caches & writes values
+// received on set topics to the registers
+type Publisher interface {
+	Start() error
+	Stop()
+}
+
+type publisherImpl struct {
+	settings model.MQTT
+	bridge   bridge.Bridge
+	// routes maps set topics to references of writable registers & bit fields
+	routes       map[string]string
+	client       paho.Client
+	subscription bridge.Subscription
+	logger       util.Logger
+	started      bool
+	mutex        sync.Mutex
+	wg           sync.WaitGroup
+}
+
+func CreatePublisher(config *model.Config, bridge bridge.Bridge) Publisher {
+	p := &publisherImpl{
+		settings: *config.MQTT,
+		bridge:   bridge,
+		routes:   make(map[string]string),
+		logger:   util.GetLogger("mqtt"),
+	}
+	for _, c := range config.Channels {
+		for _, d := range c.Devices {
+			for i := range d.Registers {
+				r := &d.Registers[i]
+				if r.Mode != model.RW && r.Mode != model.WO {
+					continue
+				}
+				reference := fmt.Sprintf("%s:%s:%s", c.Title, d.Title, r.Title)
+				p.routes[p.Topic(c.Title, d.Alias, r.Title)+"/set"] = reference
+				for _, b := range r.Bits {
+					p.routes[p.Topic(c.Title, d.Alias, r.Title+"."+b.Title)+"/set"] = reference + "." + b.Title
+				}
+			}
+		}
+	}
+	return p
+}
+
+func (p *publisherImpl) Start() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.started {
+		return nil
+	}
+	options := paho.NewClientOptions().
+		AddBroker(p.settings.Broker).
+		SetClientID(p.settings.GetClientId()).
+		SetUsername(p.settings.Username).
+		SetPassword(p.settings.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(false).
+		SetWill(p.statusTopic(), statusOffline, 1, true).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			p.logger.Warning("connection to %s lost: %v", p.settings.Broker, err)
+		})
+	client := paho.NewClient(options)
+	// an unreachable broker is not fatal: the client keeps connecting & stores messages published meanwhile
+	client.Connect()
+	p.client = client
+	p.started = true
+	p.logger.Info("start mqtt publisher on %s", p.settings.Broker)
+
+	p.subscription = p.bridge.Subscribe(bridge.SubscribeOptions{
+		Buffer:      queueSize,
+		Overflow:    bridge.OverflowCoalesce,
+		ChangesOnly: p.settings.GetPublish() == model.PublishChange,
+	})
+	p.wg.Add(1)
+	go p.publish(p.subscription)
+	return nil
+}
+func (p *publisherImpl) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.started {
+		return
+	}
+	p.started = false
+	p.logger.Info("stop mqtt publisher on %s", p.settings.Broker)
+	p.subscription.Close()
+	p.wg.Wait()
+	// a clean disconnect does not trigger the will, so the status is published explicitly
+	p.client.Publish(p.statusTopic(), 1, true, statusOffline).WaitTimeout(time.Second)
+	p.client.Disconnect(250)
+}
+
+// Topic returns the topic values of the register (or bit field, as "register.field") are published to
+func (p *publisherImpl) Topic(channel, alias, register string) string {
+	return strings.Join([]string{p.settings.GetTopic(), channel, alias, register}, "/")
+}
+func (p *publisherImpl) statusTopic() string {
+	return p.settings.GetTopic() + "/status"
+}
+
+// onConnect announces availability & (re)subscribes to set topics, as sessions are not kept by the broker
+func (p *publisherImpl) onConnect(client paho.Client) {
+	p.logger.Info("connected to %s", p.settings.Broker)
+	client.Publish(p.statusTopic(), 1, true, statusOnline)
+	// values cached before the connection would otherwise wait for their next change
+	for _, metric := range p.bridge.List() {
+		p.send(client, metric)
+	}
+	filter := p.settings.GetTopic() + "/+/+/+/set"
+	if token := client.Subscribe(filter, 1, p.onSet); token.WaitTimeout(connectTimeout) && token.Error() != nil {
+		p.logger.Error("could not subscribe to %s: %v", filter, token.Error())
+	}
+	if nil == p.settings.Discovery {
+		return
+	}
+	p.announce(client)
+	// Home Assistant announces its restart, after which entities are announced again
+	filter = p.settings.Discovery.GetPrefix() + "/status"
+	token := client.Subscribe(filter, 1, func(client paho.Client, message paho.Message) {
+		if statusOnline == string(message.Payload()) {
+			p.announce(client)
+		}
+	})
+	if token.WaitTimeout(connectTimeout) && token.Error() != nil {
+		p.logger.Error("could not subscribe to %s: %v", filter, token.Error())
+	}
+}
+
+// onSet writes the value received on a set topic to the register
+func (p *publisherImpl) onSet(_ paho.Client, message paho.Message) {
+	reference, ok := p.routes[message.Topic()]
+	if !ok {
+		p.logger.Warning("no writable register for %s", message.Topic())
+		return
+	}
+	value, err := parseSetPayload(message.Payload())
+	if err != nil {
+		p.logger.Warning("%s: %v", message.Topic(), err)
+		return
+	}
+	if err := p.bridge.Set(reference, value); err != nil {
+		p.logger.Warning("could not write %v to %s: %v", value, reference, err)
+	}
+}
+
+// publish sends changes delivered by the subscription until it is closed
+func (p *publisherImpl) publish(subscription bridge.Subscription) {
+	defer p.wg.Done()
+	for change := range subscription.Changes() {
+		p.send(p.client, change.Current)
+	}
+	if dropped := subscription.Dropped(); dropped > 0 {
+		p.logger.Warning("%d values were not published, the queue was full", dropped)
+	}
+}
+func (p *publisherImpl) send(client paho.Client, metric *model.Metric) {
+	payload, err := p.payload(metric)
+	if err != nil {
+		p.logger.Warning("could not encode %s: %v", metric.Key, err)
+		return
+	}
+	client.Publish(p.Topic(metric.Channel, metric.Alias, metric.Register), p.settings.GetQoS(), p.settings.IsRetained(), payload)
+}
+func (p *publisherImpl) payload(metric *model.Metric) ([]byte, error) {
+	if p.settings.GetPayload() == model.PayloadJSON {
+		return json.Marshal(metric)
+	}
+	if metric.IsText() {
+		return []byte(metric.Text), nil
+	}
+	return []byte(strconv.FormatFloat(metric.Value, 'f', -1, 64)), nil
+}
+
+// parseSetPayload accepts a plain number, true/false, on/off or {"value": <number>}
+func parseSetPayload(payload []byte) (float64, error) {
+	text := strings.TrimSpace(string(payload))
+	switch strings.ToLower(text) {
+	case "true", "on":
+		return 1, nil
+	case "false", "off":
+		return 0, nil
+	}
+	if v, err := strconv.ParseFloat(text, 64); err == nil {
+		return v, nil
+	}
+	var request struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(payload, &request); err != nil || nil == request.Value {
+		return 0, errors.New("payload is neither a number nor {\"value\": <number>}")
+	}
+	return *request.Value, nil
+}
@@ -0,0 +1,156 @@
+package mqtt
+
+import (
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	broker "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"mbridge/bridge"
+	"mbridge/model/modeltest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startBroker runs an embedded broker accepting any client, returning its address
+func startBroker(t *testing.T) string {
+	server := broker.New(nil)
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatalf("%s", err)
+	}
+	listener := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := server.AddListener(listener); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return "tcp://" + listener.Address()
+}
+
+// recorder keeps messages received by a test client, by topic
+type recorder struct {
+	messages map[string][]string
+	mutex    sync.Mutex
+}
+
+func (r *recorder) last(topic string) (string, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.messages[topic]) == 0 {
+		return "", 0
+	}
+	return r.messages[topic][len(r.messages[topic])-1], len(r.messages[topic])
+}
+
+// await waits for the last message on the topic to be the expected one
+func (r *recorder) await(t *testing.T, topic, expected string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if last, _ := r.last(topic); last == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			last, _ := r.last(topic)
+			t.Fatalf("expected '%s' on %s, got '%s' instead", expected, topic, last)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	address := startBroker(t)
+	config := modeltest.Config(t, fmt.Sprintf(`{"channels": [{"title": "c", "mode": "sim", "cycle_pause": "10ms", "devices": [
+		{"title": "d", "alias": "boiler", "slave_id": 1, "registers": [
+		{"title": "temp", "type": "input", "data_type": "float32", "sim": {"value": 21.5}},
+		{"title": "setpoint", "type": "holding", "address": 10, "factor": 0.5, "sim": {"value": 40}}]}]}],
+		"mqtt": {"broker": "%s", "payload": "plain", "discovery": {}}}`, address))
+
+	messages := &recorder{messages: make(map[string][]string)}
+	subscriber := paho.NewClient(paho.NewClientOptions().AddBroker(address).SetClientID("test"))
+	if token := subscriber.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatalf("%s", token.Error())
+	}
+	defer subscriber.Disconnect(0)
+	token := subscriber.SubscribeMultiple(map[string]byte{"mbridge/#": 1, "homeassistant/+/+/+/config": 1}, func(_ paho.Client, message paho.Message) {
+		messages.mutex.Lock()
+		defer messages.mutex.Unlock()
+		messages.messages[message.Topic()] = append(messages.messages[message.Topic()], string(message.Payload()))
+	})
+	if token.Wait() && token.Error() != nil {
+		t.Fatalf("%s", token.Error())
+	}
+
+	br := bridge.CreateBridge(config)
+	br.Start()
+	defer br.Stop()
+	publisher := CreatePublisher(config, br)
+	if err := publisher.Start(); err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	messages.await(t, "mbridge/status", "online")
+	messages.await(t, "mbridge/c/boiler/temp", "21.5")
+	messages.await(t, "mbridge/c/boiler/setpoint", "20")
+	// values are published on change only
+	time.Sleep(100 * time.Millisecond)
+	if _, count := messages.last("mbridge/c/boiler/temp"); 1 != count {
+		t.Errorf("expected unchanged value to be published once, got %d messages", count)
+	}
+
+	subscriber.Publish("mbridge/c/boiler/setpoint/set", 1, false, "22.5").Wait()
+	messages.await(t, "mbridge/c/boiler/setpoint", "22.5")
+
+	// entities are announced on connect & again after Home Assistant restarts
+	discovery := "homeassistant/number/mbridge/c_boiler_setpoint/config"
+	if last, _ := messages.last(discovery); !strings.Contains(last, `"command_topic":"mbridge/c/boiler/setpoint/set"`) {
+		t.Errorf("expected setpoint to be announced as number, got '%s'", last)
+	}
+	subscriber.Publish("homeassistant/status", 1, false, "online").Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, count := messages.last(discovery); 2 != count; _, count = messages.last(discovery) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected entities to be announced again, got %d announcements", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	publisher.Stop()
+	messages.await(t, "mbridge/status", "offline")
+}
+func TestPublisherUnreachableBroker(t *testing.T) {
+	config := modeltest.Config(t, `{"channels": [{"title": "c", "mode": "sim", "devices": [{"title": "d", "slave_id": 1,
+		"registers": [{"title": "r", "type": "holding"}]}]}], "mqtt": {"broker": "tcp://127.0.0.1:1"}}`)
+	publisher := CreatePublisher(config, bridge.CreateBridge(config))
+
+	// the client keeps connecting in the background
+	if err := publisher.Start(); err != nil {
+		t.Fatalf("expected start without the broker, got '%v' instead", err)
+	}
+	publisher.Stop()
+}
+func TestParseSetPayload(t *testing.T) {
+	tests := []struct {
+		payload string
+		value   float64
+	}{
+		{`22.5`, 22.5},
+		{` 1 `, 1},
+		{`ON`, 1},
+		{`false`, 0},
+		{`{"value": -3}`, -3},
+	}
+	for _, test := range tests {
+		if v, err := parseSetPayload([]byte(test.payload)); err != nil || test.value != v {
+			t.Errorf("%s: expected %v, got %v (%v)", test.payload, test.value, v, err)
+		}
+	}
+	for _, payload := range []string{``, `abc`, `{"raw": 1}`} {
+		if _, err := parseSetPayload([]byte(payload)); err == nil {
+			t.Errorf("%s: expected error", payload)
+		}
+	}
+}
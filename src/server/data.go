@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/binary"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+)
+
+// DataStore is the data model of server's units; errors are returned as by Handler
+type DataStore interface {
+	// ReadBits returns values of coils or discrete inputs
+	ReadBits(unitId uint8, table model.RegType, address, quantity uint16) ([]bool, error)
+	// ReadWords returns big-endian contents of input or holding registers
+	ReadWords(unitId uint8, table model.RegType, address, quantity uint16) ([]byte, error)
+	WriteBits(unitId uint8, address uint16, values []bool) error
+	// WriteWords writes big-endian contents of holding registers
+	WriteWords(unitId uint8, address uint16, data []byte) error
+}
+
+// dataHandler decodes read & write requests of the public function codes into data store calls
+type dataHandler struct {
+	store DataStore
+}
+
+func NewDataHandler(store DataStore) Handler {
+	return &dataHandler{store: store}
+}
+
+func (h *dataHandler) Handle(unitId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error) {
+	fc, data := request.FunctionCode, request.Data
+	switch fc {
+	case modbus.FuncCodeReadCoils, modbus.FuncCodeReadDiscreteInputs:
+		address, quantity, err := addressQuantity(fc, data, 2000)
+		if err != nil {
+			return nil, err
+		}
+		table := model.COIL
+		if fc == modbus.FuncCodeReadDiscreteInputs {
+			table = model.DISCRETE
+		}
+		bits, err := h.store.ReadBits(unitId, table, address, quantity)
+		if err != nil {
+			return nil, err
+		}
+		packed := packBits(bits)
+		return &modbus.ProtocolDataUnit{FunctionCode: fc, Data: append([]byte{byte(len(packed))}, packed...)}, nil
+	case modbus.FuncCodeReadHoldingRegisters, modbus.FuncCodeReadInputRegisters:
+		address, quantity, err := addressQuantity(fc, data, 125)
+		if err != nil {
+			return nil, err
+		}
+		table := model.HOLDING
+		if fc == modbus.FuncCodeReadInputRegisters {
+			table = model.INPUT
+		}
+		words, err := h.store.ReadWords(unitId, table, address, quantity)
+		if err != nil {
+			return nil, err
+		}
+		return &modbus.ProtocolDataUnit{FunctionCode: fc, Data: append([]byte{byte(len(words))}, words...)}, nil
+	case modbus.FuncCodeWriteSingleCoil:
+		if len(data) != 4 || (data[2] != 0x00 && data[2] != 0xFF) || data[3] != 0 {
+			return nil, NewException(fc, modbus.ExceptionCodeIllegalDataValue)
+		}
+		if err := h.store.WriteBits(unitId, binary.BigEndian.Uint16(data), []bool{data[2] == 0xFF}); err != nil {
+			return nil, err
+		}
+		return request, nil
+	case modbus.FuncCodeWriteSingleRegister:
+		if len(data) != 4 {
+			return nil, NewException(fc, modbus.ExceptionCodeIllegalDataValue)
+		}
+		if err := h.store.WriteWords(unitId, binary.BigEndian.Uint16(data), data[2:4]); err != nil {
+			return nil, err
+		}
+		return request, nil
+	case modbus.FuncCodeWriteMultipleCoils:
+		address, quantity, err := addressQuantity(fc, data, 1968)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != 5+int(data[4]) || int(data[4]) != (int(quantity)+7)/8 {
+			return nil, NewException(fc, modbus.ExceptionCodeIllegalDataValue)
+		}
+		if err := h.store.WriteBits(unitId, address, unpackBits(data[5:], int(quantity))); err != nil {
+			return nil, err
+		}
+		return &modbus.ProtocolDataUnit{FunctionCode: fc, Data: data[:4]}, nil
+	case modbus.FuncCodeWriteMultipleRegisters:
+		address, quantity, err := addressQuantity(fc, data, 123)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) != 5+int(data[4]) || int(data[4]) != 2*int(quantity) {
+			return nil, NewException(fc, modbus.ExceptionCodeIllegalDataValue)
+		}
+		if err := h.store.WriteWords(unitId, address, data[5:]); err != nil {
+			return nil, err
+		}
+		return &modbus.ProtocolDataUnit{FunctionCode: fc, Data: data[:4]}, nil
+	default:
+		return nil, NewException(fc, modbus.ExceptionCodeIllegalFunction)
+	}
+}
+
+// addressQuantity parses starting address & quantity of the request, checking quantity limit
+func addressQuantity(fc byte, data []byte, limit uint16) (uint16, uint16, error) {
+	if len(data) < 4 {
+		return 0, 0, NewException(fc, modbus.ExceptionCodeIllegalDataValue)
+	}
+	address, quantity := binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+	if quantity < 1 || quantity > limit {
+		return 0, 0, NewException(fc, modbus.ExceptionCodeIllegalDataValue)
+	}
+	if int(address)+int(quantity) > 0x10000 {
+		return 0, 0, NewException(fc, modbus.ExceptionCodeIllegalDataAddress)
+	}
+	return address, quantity, nil
+}
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+func unpackBits(packed []byte, count int) []bool {
+	bits := make([]bool, count)
+	for i := range bits {
+		bits[i] = packed[i/8]&(1<<(i%8)) != 0
+	}
+	return bits
+}
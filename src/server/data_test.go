@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"github.com/mvkvl/modbus"
+	"mbridge/model"
+	"testing"
+)
+
+// memoryStore keeps a single table of each kind starting at address 0
+type memoryStore struct {
+	bits  []bool
+	words []byte
+}
+
+func (s *memoryStore) ReadBits(unitId uint8, table model.RegType, address, quantity uint16) ([]bool, error) {
+	if int(address+quantity) > len(s.bits) {
+		return nil, NewException(0, modbus.ExceptionCodeIllegalDataAddress)
+	}
+	return s.bits[address : address+quantity], nil
+}
+func (s *memoryStore) ReadWords(unitId uint8, table model.RegType, address, quantity uint16) ([]byte, error) {
+	if 2*int(address+quantity) > len(s.words) {
+		return nil, NewException(0, modbus.ExceptionCodeIllegalDataAddress)
+	}
+	return s.words[2*address : 2*(address+quantity)], nil
+}
+func (s *memoryStore) WriteBits(unitId uint8, address uint16, values []bool) error {
+	copy(s.bits[address:], values)
+	return nil
+}
+func (s *memoryStore) WriteWords(unitId uint8, address uint16, data []byte) error {
+	copy(s.words[2*address:], data)
+	return nil
+}
+
+func TestDataHandler(t *testing.T) {
+	store := &memoryStore{bits: make([]bool, 10), words: make([]byte, 8)}
+	handler := NewDataHandler(store)
+
+	request := &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteMultipleCoils, Data: []byte{0, 1, 0, 9, 2, 0xFF, 0x01}}
+	if _, err := handler.Handle(1, request); err != nil {
+		t.Fatalf("%s", err)
+	}
+	response, err := handler.Handle(1, &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadCoils, Data: []byte{0, 0, 0, 10}})
+	if err != nil || "\x02\xfe\x03" != string(response.Data) {
+		t.Errorf("expected coils 1-9 on, got '% x' (%v)", response.Data, err)
+	}
+
+	request = &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleRegister, Data: []byte{0, 2, 0x12, 0x34}}
+	if response, err := handler.Handle(1, request); err != nil || string(request.Data) != string(response.Data) {
+		t.Errorf("expected echo of the request, got '%v' (%v)", response, err)
+	}
+	response, err = handler.Handle(1, &modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadHoldingRegisters, Data: []byte{0, 2, 0, 1}})
+	if err != nil || "\x02\x12\x34" != string(response.Data) {
+		t.Errorf("expected register value 0x1234, got '% x' (%v)", response.Data, err)
+	}
+
+	for _, test := range []struct {
+		request *modbus.ProtocolDataUnit
+		code    byte
+	}{
+		{&modbus.ProtocolDataUnit{FunctionCode: 0x2B, Data: []byte{0x0E}}, modbus.ExceptionCodeIllegalFunction},
+		{&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadCoils, Data: []byte{0, 0, 0, 0}}, modbus.ExceptionCodeIllegalDataValue},
+		{&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeWriteSingleCoil, Data: []byte{0, 0, 0x12, 0}}, modbus.ExceptionCodeIllegalDataValue},
+		{&modbus.ProtocolDataUnit{FunctionCode: modbus.FuncCodeReadInputRegisters, Data: []byte{0, 3, 0, 2}}, modbus.ExceptionCodeIllegalDataAddress},
+	} {
+		_, err := handler.Handle(1, test.request)
+		var modbusError *modbus.ModbusError
+		if !errors.As(err, &modbusError) || test.code != modbusError.ExceptionCode {
+			t.Errorf("function %d: expected exception %d, got '%v'", test.request.FunctionCode, test.code, err)
+			continue
+		}
+		if exception := Exception(test.request.FunctionCode, err); test.request.FunctionCode|0x80 != exception.FunctionCode || test.code != exception.Data[0] {
+			t.Errorf("function %d: unexpected exception response %v", test.request.FunctionCode, exception)
+		}
+	}
+}
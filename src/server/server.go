@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/mvkvl/modbus"
+	"io"
+	"mbridge/util"
+	"net"
+	"sync"
+)
+
+const (
+	// MBAP header: transaction id, protocol id, length & unit id
+	mbapHeaderSize = 7
+	// unit id + function code + up to 252 bytes of data
+	mbapMaxLength = 254
+)
+
+// Handler serves requests addressed to the server's units
+type Handler interface {
+	// Handle returns the response to the request; a *modbus.ModbusError is answered with
+	// its exception code, any other error with server device failure
+	Handle(unitId uint8, request *modbus.ProtocolDataUnit) (*modbus.ProtocolDataUnit, error)
+}
+
+// Server is a Modbus TCP server passing requests to its handler
+type Server interface {
+	Start() error
+	Stop()
+	Addr() net.Addr
+}
+
+type serverImpl struct {
+	address  string
+	handler  Handler
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	logger   util.Logger
+	started  bool
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+}
+
+func CreateServer(address string, handler Handler) Server {
+	return &serverImpl{
+		address: address,
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+		logger:  util.GetLogger("modbus-server"),
+	}
+}
+
+func (s *serverImpl) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return nil
+	}
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.started = true
+	s.logger.Info("start modbus server on %s", listener.Addr())
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					s.logger.Warning("accept error: %v", err)
+				}
+				return
+			}
+			// a connection accepted while the server stops would not be closed by Stop
+			s.mutex.Lock()
+			if !s.started {
+				s.mutex.Unlock()
+				conn.Close()
+				return
+			}
+			s.conns[conn] = struct{}{}
+			s.wg.Add(1)
+			s.mutex.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return nil
+}
+func (s *serverImpl) Stop() {
+	s.mutex.Lock()
+	if !s.started {
+		s.mutex.Unlock()
+		return
+	}
+	s.started = false
+	s.logger.Info("stop modbus server on %s", s.listener.Addr())
+	s.listener.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+func (s *serverImpl) Addr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// serve answers client's requests one by one, echoing transaction id of each request
+func (s *serverImpl) serve(conn net.Conn) {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+	s.logger.Debug("client connected: %s", conn.RemoteAddr())
+	var header [mbapHeaderSize]byte
+	for {
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if binary.BigEndian.Uint16(header[2:]) != 0 || length < 2 || length > mbapMaxLength {
+			s.logger.Warning("invalid request header from %s: % x", conn.RemoteAddr(), header)
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+		response := s.handle(header[6], &modbus.ProtocolDataUnit{FunctionCode: pdu[0], Data: pdu[1:]})
+		adu := make([]byte, mbapHeaderSize, mbapHeaderSize+1+len(response.Data))
+		copy(adu, header[:])
+		binary.BigEndian.PutUint16(adu[4:], uint16(2+len(response.Data)))
+		adu = append(append(adu, response.FunctionCode), response.Data...)
+		if _, err := conn.Write(adu); err != nil {
+			return
+		}
+	}
+}
+func (s *serverImpl) handle(unitId uint8, request *modbus.ProtocolDataUnit) *modbus.ProtocolDataUnit {
+	response, err := s.handler.Handle(unitId, request)
+	if err == nil {
+		return response
+	}
+	s.logger.Debug("unit %d, function %d: %v", unitId, request.FunctionCode, err)
+	return Exception(request.FunctionCode, err)
+}
+
+// Exception builds the exception response for the error
+func Exception(functionCode byte, err error) *modbus.ProtocolDataUnit {
+	code := byte(modbus.ExceptionCodeServerDeviceFailure)
+	var modbusError *modbus.ModbusError
+	if errors.As(err, &modbusError) {
+		code = modbusError.ExceptionCode
+	}
+	return &modbus.ProtocolDataUnit{FunctionCode: functionCode | 0x80, Data: []byte{code}}
+}
+
+// NewException returns the error to answer the request with the exception code
+func NewException(functionCode byte, code byte) error {
+	return &modbus.ModbusError{FunctionCode: functionCode, ExceptionCode: code}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestServerStop has clients connecting while the server stops, which must not wait for them to disconnect
+func TestServerStop(t *testing.T) {
+	for range 20 {
+		server := CreateServer("127.0.0.1:0", NewDataHandler(&memoryStore{}))
+		if err := server.Start(); err != nil {
+			t.Fatalf("%s", err)
+		}
+		address := server.Addr().String()
+		quit := make(chan struct{})
+		dialing := make(chan struct{})
+		go func() {
+			defer close(dialing)
+			var conns []net.Conn
+			defer func() {
+				for _, conn := range conns {
+					conn.Close()
+				}
+			}()
+			for {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+				if conn, err := net.Dial("tcp", address); err == nil {
+					conns = append(conns, conn)
+				}
+			}
+		}()
+		time.Sleep(time.Millisecond)
+
+		stopped := make(chan struct{})
+		go func() {
+			server.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected stop not to wait for connected clients")
+		}
+		close(quit)
+		<-dialing
+	}
+}
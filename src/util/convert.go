@@ -20,6 +20,16 @@ func ToFloat64(unk any) (float64, error) {
 		return float64(i), nil
 	case int8:
 		return float64(i), nil
+	case int:
+		return float64(i), nil
+	case uint64:
+		return float64(i), nil
+	case uint32:
+		return float64(i), nil
+	case uint16:
+		return float64(i), nil
+	case uint8:
+		return float64(i), nil
 	default:
 		return math.NaN(), errors.New("convert: unknown value is of incompatible type")
 	}
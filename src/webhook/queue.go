@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mbridge/util"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// delivery is a call of a webhook; its id is sent along, so that receivers can recognize repeated ones
+type delivery struct {
+	Id      string    `json:"id"`
+	Webhook string    `json:"webhook"`
+	Body    string    `json:"body"`
+	Created time.Time `json:"created"`
+}
+
+// failureQueue keeps deliveries which failed after their retries in a file, so that they survive restarts
+type failureQueue struct {
+	path       string
+	size       int
+	deliveries []delivery
+	logger     util.Logger
+	mutex      sync.Mutex
+}
+
+// openFailureQueue loads deliveries kept by a previous run
+func openFailureQueue(path string, size int, logger util.Logger) (*failureQueue, error) {
+	q := &failureQueue{path: path, size: size, logger: logger}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &q.deliveries)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read failure queue %s: %w", path, err)
+	}
+	return q, nil
+}
+
+// push keeps the delivery, dropping the oldest one if the queue is full
+func (q *failureQueue) push(d delivery) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.deliveries = append(q.deliveries, d)
+	if len(q.deliveries) > q.size {
+		q.logger.Warning("failure queue is full, dropping delivery %s of %s", q.deliveries[0].Id, q.deliveries[0].Webhook)
+		q.deliveries = slices.Delete(q.deliveries, 0, 1)
+	}
+	q.save()
+}
+
+// retry passes queued deliveries to send in order & removes the ones it reports done; send is
+// called without the lock held, so that deliveries failing meanwhile are queued
+func (q *failureQueue) retry(send func(d delivery) bool) {
+	q.mutex.Lock()
+	pending := slices.Clone(q.deliveries)
+	q.mutex.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	done := make(map[string]bool)
+	for _, d := range pending {
+		if send(d) {
+			done[d.Id] = true
+		}
+	}
+	if len(done) == 0 {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.deliveries = slices.DeleteFunc(q.deliveries, func(d delivery) bool { return done[d.Id] })
+	q.save()
+}
+
+// holds reports whether deliveries of the webhook wait in the queue
+func (q *failureQueue) holds(webhook string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return slices.ContainsFunc(q.deliveries, func(d delivery) bool { return d.Webhook == webhook })
+}
+func (q *failureQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.deliveries)
+}
+
+// save replaces the file, so that a crash leaves either the previous or the current contents
+func (q *failureQueue) save() {
+	data, err := json.Marshal(q.deliveries)
+	if err == nil {
+		temp := filepath.Join(filepath.Dir(q.path), "."+filepath.Base(q.path)+".tmp")
+		if err = os.WriteFile(temp, data, 0o600); err == nil {
+			err = os.Rename(temp, q.path)
+		}
+	}
+	if err != nil {
+		q.logger.Error("could not save failure queue %s: %v", q.path, err)
+	}
+}
@@ -0,0 +1,341 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mbridge/bridge"
+	"mbridge/model"
+	"mbridge/util"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const (
+	// eventBuffer is the number of changes waiting to be evaluated, further ones are dropped
+	eventBuffer = 1024
+	// hookBuffer is the number of calls of a hook waiting to be made, further ones go to the failure queue
+	hookBuffer = 64
+
+	webhookHeader   = "X-Mbridge-Webhook"
+	deliveryHeader  = "X-Mbridge-Delivery"
+	signatureHeader = "X-Mbridge-Signature"
+)
+
+// templateFuncs are available to body templates besides the event's fields
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		buff, err := json.Marshal(v)
+		return string(buff), err
+	},
+}
+
+// Sender is the webhook sink: it calls webhooks whose triggers are met by metrics set in channels' caches
+type Sender interface {
+	Start() error
+	Stop()
+}
+
+type hook struct {
+	settings   model.Webhook
+	references map[string]bool
+	// body renders the request body, the event is sent as JSON without it
+	body   *template.Template
+	client *http.Client
+	// states of references are only used by the evaluating goroutine
+	states     map[string]string
+	deliveries chan delivery
+}
+
+type senderImpl struct {
+	settings     model.Webhooks
+	bridge       bridge.Bridge
+	hooks        []*hook
+	queue        *failureQueue
+	subscription bridge.Subscription
+	cancel       context.CancelFunc
+	sequence     atomic.Uint64
+	logger       util.Logger
+	started      bool
+	mutex        sync.Mutex
+	evaluating   sync.WaitGroup
+	wg           sync.WaitGroup
+}
+
+func CreateSender(config *model.Config, bridge bridge.Bridge) (Sender, error) {
+	s := &senderImpl{
+		settings: *config.Webhooks,
+		bridge:   bridge,
+		logger:   util.GetLogger("webhook"),
+	}
+	for _, w := range config.Webhooks.Hooks {
+		h := &hook{
+			settings:   w,
+			references: make(map[string]bool),
+			client:     &http.Client{Timeout: w.GetTimeout()},
+			states:     make(map[string]string),
+			deliveries: make(chan delivery, hookBuffer),
+		}
+		for _, reference := range w.References {
+			h.references[strings.TrimSpace(reference)] = true
+		}
+		if w.Body != "" {
+			body, err := template.New(w.Title).Funcs(templateFuncs).Parse(w.Body)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: invalid body: %w", w.Title, err)
+			}
+			h.body = body
+		}
+		s.hooks = append(s.hooks, h)
+	}
+	return s, nil
+}
+
+func (s *senderImpl) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return nil
+	}
+	queue, err := openFailureQueue(s.settings.GetQueue(), s.settings.GetQueueSize(), s.logger)
+	if err != nil {
+		return err
+	}
+	s.queue = queue
+	s.started = true
+	s.logger.Info("start webhooks: %d hooks, %d queued deliveries", len(s.hooks), queue.len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.subscription = s.bridge.Subscribe(bridge.SubscribeOptions{
+		Buffer:      eventBuffer,
+		Overflow:    bridge.OverflowDrop,
+		Filter:      s.referenced,
+		ChangesOnly: true,
+	})
+	s.evaluating.Add(1)
+	go s.evaluate(s.subscription)
+	s.wg.Add(len(s.hooks) + 1)
+	for _, h := range s.hooks {
+		go s.work(ctx, h)
+	}
+	go s.redeliver(ctx)
+	return nil
+}
+
+// Stop waits for calls in progress to be cancelled, calls not made go to the failure queue
+func (s *senderImpl) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.started {
+		return
+	}
+	s.started = false
+	s.logger.Info("stop webhooks")
+	s.subscription.Close()
+	s.evaluating.Wait()
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *senderImpl) referenced(metric *model.Metric) bool {
+	for _, h := range s.hooks {
+		if h.references[metric.Key] {
+			return true
+		}
+	}
+	return false
+}
+func (s *senderImpl) hook(title string) *hook {
+	for _, h := range s.hooks {
+		if h.settings.Title == title {
+			return h
+		}
+	}
+	return nil
+}
+
+// evaluate passes changes delivered by the subscription to hooks' triggers until it is closed
+func (s *senderImpl) evaluate(subscription bridge.Subscription) {
+	defer s.evaluating.Done()
+	for change := range subscription.Changes() {
+		for _, h := range s.hooks {
+			if !h.references[change.Current.Key] {
+				continue
+			}
+			event, ok := h.evaluate(change)
+			if !ok {
+				continue
+			}
+			body, err := h.render(event)
+			if err != nil {
+				s.logger.Warning("%s: could not render body of %s: %v", h.settings.Title, event.Reference, err)
+				continue
+			}
+			d := delivery{Id: s.nextId(), Webhook: h.settings.Title, Body: string(body), Created: time.Now()}
+			select {
+			case h.deliveries <- d:
+			default:
+				s.logger.Warning("%s: too many calls waiting, delivery %s is queued", h.settings.Title, d.Id)
+				s.queue.push(d)
+			}
+		}
+	}
+	if dropped := subscription.Dropped(); dropped > 0 {
+		s.logger.Warning("%d changes were not evaluated, the buffer was full", dropped)
+	}
+}
+func (s *senderImpl) nextId() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(s.sequence.Add(1), 10)
+}
+func (h *hook) render(event Event) ([]byte, error) {
+	if nil == h.body {
+		return json.Marshal(event)
+	}
+	var buff bytes.Buffer
+	err := h.body.Execute(&buff, event)
+	return buff.Bytes(), err
+}
+
+// work makes hook's calls one after another & queues them behind hook's deliveries waiting in the
+// failure queue, so that receivers get them in order; only calls beyond the hook buffer, which are
+// queued right away, may overtake the ones waiting in the buffer
+func (s *senderImpl) work(ctx context.Context, h *hook) {
+	defer s.wg.Done()
+	for {
+		select {
+		case d := <-h.deliveries:
+			if s.queue.holds(h.settings.Title) {
+				s.queue.push(d)
+				continue
+			}
+			s.deliver(ctx, h, d)
+		case <-ctx.Done():
+			for {
+				select {
+				case d := <-h.deliveries:
+					s.queue.push(d)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver makes the call, retrying temporary failures with back-off doubling up to the maximum;
+// a call failing after the retries goes to the failure queue, a rejected one is dropped
+func (s *senderImpl) deliver(ctx context.Context, h *hook, d delivery) {
+	backoff, maxBackoff := h.settings.GetBackoff()
+	for retry := 0; ; retry++ {
+		temporary, err := s.call(ctx, h, d)
+		if err == nil {
+			s.logger.Debug("%s: delivery %s done", h.settings.Title, d.Id)
+			return
+		}
+		if !temporary {
+			s.logger.Error("%s: delivery %s rejected: %v", h.settings.Title, d.Id, err)
+			return
+		}
+		if retry == h.settings.GetRetries() {
+			s.logger.Error("%s: delivery %s failed, it is queued: %v", h.settings.Title, d.Id, err)
+			s.queue.push(d)
+			return
+		}
+		s.logger.Warning("%s: delivery %s failed, retrying in %s: %v", h.settings.Title, d.Id, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			s.queue.push(d)
+			return
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// call makes a single attempt of the delivery; failures which may pass by themselves are temporary:
+// those of the connection, timeouts, server errors & rate limiting
+func (s *senderImpl) call(ctx context.Context, h *hook, d delivery) (temporary bool, err error) {
+	request, err := http.NewRequestWithContext(ctx, h.settings.GetMethod(), h.settings.URL, strings.NewReader(d.Body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range h.settings.Headers {
+		request.Header.Set(key, value)
+	}
+	request.Header.Set(webhookHeader, h.settings.Title)
+	request.Header.Set(deliveryHeader, d.Id)
+	if h.settings.Secret != "" {
+		request.Header.Set(signatureHeader, "sha256="+sign(h.settings.Secret, []byte(d.Body)))
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	// reading the rest of the response lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode >= 500, response.StatusCode == http.StatusTooManyRequests, response.StatusCode == http.StatusRequestTimeout:
+		return true, fmt.Errorf("response %s", response.Status)
+	}
+	return false, fmt.Errorf("response %s", response.Status)
+}
+
+// redeliver retries queued deliveries every redeliver interval; once a call of a hook fails
+// temporarily, its further deliveries wait for the next round, so that their order is kept
+func (s *senderImpl) redeliver(ctx context.Context) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.settings.GetRedeliver())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		failing := make(map[string]bool)
+		s.queue.retry(func(d delivery) bool {
+			h := s.hook(d.Webhook)
+			if nil == h {
+				s.logger.Warning("delivery %s of unknown webhook %s is dropped", d.Id, d.Webhook)
+				return true
+			}
+			if failing[d.Webhook] || ctx.Err() != nil {
+				return false
+			}
+			temporary, err := s.call(ctx, h, d)
+			switch {
+			case err == nil:
+				s.logger.Info("%s: queued delivery %s done", d.Webhook, d.Id)
+			case temporary:
+				s.logger.Debug("%s: queued delivery %s failed: %v", d.Webhook, d.Id, err)
+				failing[d.Webhook] = true
+				return false
+			default:
+				s.logger.Error("%s: queued delivery %s rejected: %v", d.Webhook, d.Id, err)
+			}
+			return true
+		})
+	}
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body with the secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
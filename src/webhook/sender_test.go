@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"mbridge/bridge"
+	"mbridge/model"
+	"mbridge/model/modeltest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cacheBridge serves subscriptions of a cache the test sets metrics in
+type cacheBridge struct {
+	bridge.Bridge
+	cache bridge.MetricCache
+}
+
+func (b *cacheBridge) Subscribe(options bridge.SubscribeOptions) bridge.Subscription {
+	return b.cache.Subscribe(options)
+}
+func (b *cacheBridge) set(key string, value float64) {
+	b.cache.Set(key, &model.Metric{Key: key, RawValue: uint16(value), Value: value, Timestamp: time.Now()})
+}
+
+type request struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// standIn is the receiving end of webhooks: it records requests & answers the given number of them
+// with the failure status, further ones with OK
+type standIn struct {
+	*httptest.Server
+	failure  int
+	failures int
+	requests []request
+	mutex    sync.Mutex
+}
+
+func startStandIn(t *testing.T) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.requests = append(s.requests, request{r.Method, r.Header, string(body)})
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(s.failure)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+func (s *standIn) fail(status, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failure, s.failures = status, count
+}
+func (s *standIn) received() []request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]request(nil), s.requests...)
+}
+
+// await waits for the number of requests to be received
+func (s *standIn) await(t *testing.T, count int) []request {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if requests := s.received(); len(requests) >= count {
+			return requests
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d requests, got %d", count, len(s.received()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testSender(t *testing.T, hooks string) (Sender, *cacheBridge) {
+	t.Helper()
+	config := modeltest.Config(t, `{"channels": [{"title": "msw-b", "devices": [{"title": "d", "registers": [{"title": "CO2"}, {"title": "alarm", "type": "coil"},
+		{"title": "status", "type": "holding", "bits": [{"title": "fault", "bit": 0}]}]}]}],
+		"webhooks": {"queue": "`+filepath.Join(t.TempDir(), "webhooks.queue")+`", "redeliver": "20ms", "hooks": `+hooks+`}}`)
+	br := &cacheBridge{cache: bridge.CreateMetricCache(time.Minute)}
+	sender, err := CreateSender(config, br)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := sender.Start(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	t.Cleanup(sender.Stop)
+	return sender, br
+}
+
+func TestSenderThreshold(t *testing.T) {
+	server := startStandIn(t)
+	_, br := testSender(t, `[{"title": "co2", "url": "`+server.URL+`/tickets", "method": "PUT", "secret": "s3cret",
+		"headers": {"Authorization": "Bearer token", "Content-Type": "text/plain"},
+		"body": "{{.Reference}} is {{.State}} at {{.Value}}", "trigger": "threshold", "above": 1200, "hysteresis": 50,
+		"references": ["msw-b:d:CO2"]}]`)
+
+	for _, value := range []float64{800, 1300, 1250, 1180, 1100} {
+		br.set("msw-b:d:CO2", value)
+	}
+	// other references are not evaluated
+	br.set("msw-b:d:alarm", 1)
+	server.await(t, 2)
+	time.Sleep(50 * time.Millisecond)
+	requests := server.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+
+	expected := []string{"msw-b:d:CO2 is above at 1300", "msw-b:d:CO2 is normal at 1100"}
+	for i, r := range requests {
+		if r.method != http.MethodPut || r.body != expected[i] {
+			t.Errorf("expected PUT '%s', got %s '%s'", expected[i], r.method, r.body)
+		}
+		if r.header.Get("Authorization") != "Bearer token" || r.header.Get("Content-Type") != "text/plain" {
+			t.Errorf("expected configured headers, got %v", r.header)
+		}
+		if r.header.Get(signatureHeader) != "sha256="+sign("s3cret", []byte(r.body)) {
+			t.Errorf("unexpected signature '%s'", r.header.Get(signatureHeader))
+		}
+		if r.header.Get(webhookHeader) != "co2" || r.header.Get(deliveryHeader) == "" {
+			t.Errorf("expected webhook & delivery headers, got %v", r.header)
+		}
+	}
+}
+
+func TestSenderDefaultBody(t *testing.T) {
+	server := startStandIn(t)
+	_, br := testSender(t, `[{"title": "alarm", "url": "`+server.URL+`", "trigger": "state", "references": ["msw-b:d:alarm"]}]`)
+
+	br.set("msw-b:d:alarm", 0)
+	br.set("msw-b:d:alarm", 1)
+	r := server.await(t, 1)[0]
+	var event Event
+	if err := json.Unmarshal([]byte(r.body), &event); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if r.method != http.MethodPost || r.header.Get("Content-Type") != "application/json" || r.header.Get(signatureHeader) != "" {
+		t.Errorf("expected unsigned JSON POST, got %s %v", r.method, r.header)
+	}
+	if event.Webhook != "alarm" || event.Trigger != "state" || event.State != stateOn || nil == event.Previous || *event.Previous != 0 {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestSenderBitField(t *testing.T) {
+	server := startStandIn(t)
+	_, br := testSender(t, `[{"title": "fault", "url": "`+server.URL+`", "trigger": "state", "body": "{{.Reference}} {{.State}}",
+		"references": ["msw-b:d:status.fault"]}]`)
+
+	br.set("msw-b:d:status.fault", 0)
+	br.set("msw-b:d:status.fault", 1)
+	if r := server.await(t, 1)[0]; r.body != "msw-b:d:status.fault on" {
+		t.Errorf("expected bit field to be on, got '%s'", r.body)
+	}
+}
+
+func TestSenderRetries(t *testing.T) {
+	server := startStandIn(t)
+	server.fail(http.StatusServiceUnavailable, 2)
+	_, br := testSender(t, `[{"title": "co2", "url": "`+server.URL+`", "retries": 3, "backoff": "10ms",
+		"references": ["msw-b:d:CO2"]}]`)
+
+	br.set("msw-b:d:CO2", 800)
+	br.set("msw-b:d:CO2", 900)
+	server.await(t, 3)
+	time.Sleep(100 * time.Millisecond)
+	requests := server.received()
+	if len(requests) != 3 {
+		t.Fatalf("expected delivery to stop after success, got %d requests", len(requests))
+	}
+	for _, r := range requests {
+		if r.header.Get(deliveryHeader) != requests[0].header.Get(deliveryHeader) {
+			t.Errorf("expected retries of the same delivery, got %s & %s", r.header.Get(deliveryHeader), requests[0].header.Get(deliveryHeader))
+		}
+	}
+}
+
+func TestSenderOrder(t *testing.T) {
+	server := startStandIn(t)
+	server.fail(http.StatusBadGateway, 1)
+	_, br := testSender(t, `[{"title": "co2", "url": "`+server.URL+`", "retries": 0, "body": "{{.Value}}",
+		"references": ["msw-b:d:CO2"]}]`)
+
+	br.set("msw-b:d:CO2", 800)
+	br.set("msw-b:d:CO2", 900)
+	server.await(t, 1)
+	time.Sleep(5 * time.Millisecond)
+	// the next delivery waits behind the failed one
+	br.set("msw-b:d:CO2", 1000)
+	requests := server.await(t, 3)
+	if requests[1].body != "900" || requests[2].body != "1000" {
+		t.Errorf("expected deliveries in order, got '%s' & '%s'", requests[1].body, requests[2].body)
+	}
+}
+
+func TestSenderRejected(t *testing.T) {
+	server := startStandIn(t)
+	server.fail(http.StatusBadRequest, 100)
+	sender, br := testSender(t, `[{"title": "co2", "url": "`+server.URL+`", "backoff": "10ms", "references": ["msw-b:d:CO2"]}]`)
+
+	br.set("msw-b:d:CO2", 800)
+	br.set("msw-b:d:CO2", 900)
+	server.await(t, 1)
+	time.Sleep(100 * time.Millisecond)
+	if requests := server.received(); len(requests) != 1 {
+		t.Errorf("expected rejected delivery not to be retried, got %d requests", len(requests))
+	}
+	if n := sender.(*senderImpl).queue.len(); n != 0 {
+		t.Errorf("expected rejected delivery not to be queued, got %d", n)
+	}
+}
+
+func TestSenderFailureQueue(t *testing.T) {
+	server := startStandIn(t)
+	server.fail(http.StatusBadGateway, 100)
+	sender, br := testSender(t, `[{"title": "co2", "url": "`+server.URL+`", "retries": 0, "references": ["msw-b:d:CO2"]}]`)
+	path := sender.(*senderImpl).settings.GetQueue()
+
+	br.set("msw-b:d:CO2", 800)
+	br.set("msw-b:d:CO2", 900)
+	// the failed delivery is retried from the queue until it passes
+	server.await(t, 3)
+	sender.Stop()
+	var queued []delivery
+	if data, err := os.ReadFile(path); err != nil || json.Unmarshal(data, &queued) != nil || len(queued) != 1 {
+		t.Fatalf("expected 1 queued delivery, got '%s' (%v)", data, err)
+	}
+
+	// the queue is kept over restarts
+	server.fail(http.StatusBadGateway, 0)
+	if err := sender.Start(); err != nil {
+		t.Fatalf("%s", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sender.(*senderImpl).queue.len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected queued delivery to be redelivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	requests := server.await(t, 4)
+	last := requests[len(requests)-1]
+	if last.header.Get(deliveryHeader) != queued[0].Id || last.body != queued[0].Body {
+		t.Errorf("expected queued delivery %s, got %s", queued[0].Id, last.header.Get(deliveryHeader))
+	}
+	if data, _ := os.ReadFile(path); string(data) != "[]" {
+		t.Errorf("expected empty queue file, got '%s'", data)
+	}
+}
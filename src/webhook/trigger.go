@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"mbridge/bridge"
+	"mbridge/model"
+	"time"
+)
+
+const (
+	stateAbove  = "above"
+	stateBelow  = "below"
+	stateNormal = "normal"
+	stateOn     = "on"
+	stateOff    = "off"
+)
+
+// Event is a metric meeting a webhook's trigger; it is the data of body templates & the default body
+type Event struct {
+	Webhook   string        `json:"webhook"`
+	Trigger   string        `json:"trigger"`
+	Reference string        `json:"reference"`
+	State     string        `json:"state,omitempty"`
+	Value     float64       `json:"value"`
+	Previous  *float64      `json:"previous,omitempty"`
+	Metric    *model.Metric `json:"metric"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// evaluate returns the event of the change, if it meets the hook's trigger; states of references
+// are kept by the hook, the first value of a reference only sets its state, unless it is beyond a threshold
+func (h *hook) evaluate(change bridge.Change) (Event, bool) {
+	current := change.Current
+	event := Event{
+		Webhook:   h.settings.Title,
+		Trigger:   h.settings.GetTrigger().String(),
+		Reference: current.Key,
+		Value:     current.Value,
+		Metric:    current,
+		Timestamp: current.Timestamp,
+	}
+	if nil != change.Previous {
+		event.Previous = &change.Previous.Value
+	}
+	switch h.settings.GetTrigger() {
+	case model.THRESHOLD:
+		previous, known := h.states[current.Key]
+		event.State = h.threshold(previous, current.Value)
+		h.states[current.Key] = event.State
+		if known {
+			return event, event.State != previous
+		}
+		return event, event.State != stateNormal
+	case model.STATE:
+		previous, known := h.states[current.Key]
+		event.State = stateOff
+		if current.Value != 0 {
+			event.State = stateOn
+		}
+		h.states[current.Key] = event.State
+		return event, known && event.State != previous
+	default:
+		return event, nil != change.Previous && change.Changed()
+	}
+}
+
+// threshold returns the state of the value: a value beyond a threshold has to get back by more
+// than the hysteresis to be normal again
+func (h *hook) threshold(previous string, value float64) string {
+	above, below, hysteresis := h.settings.Above, h.settings.Below, h.settings.Hysteresis
+	switch {
+	case nil != above && (value > *above || previous == stateAbove && value > *above-hysteresis):
+		return stateAbove
+	case nil != below && (value < *below || previous == stateBelow && value < *below+hysteresis):
+		return stateBelow
+	}
+	return stateNormal
+}
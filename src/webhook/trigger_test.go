@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"fmt"
+	"mbridge/bridge"
+	"mbridge/model"
+	"slices"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	above, below := 30.0, 10.0
+	tests := []struct {
+		settings model.Webhook
+		values   []float64
+		expected []string
+	}{
+		// the first value only fires beyond a threshold
+		{model.Webhook{Trigger: model.THRESHOLD, Above: &above, Below: &below, Hysteresis: 2},
+			[]float64{35, 29, 27, 20, 9, 11, 13, 31}, []string{"35 above", "27 normal", "9 below", "13 normal", "31 above"}},
+		{model.Webhook{Trigger: model.THRESHOLD, Below: &below},
+			[]float64{20, 5, 10}, []string{"5 below", "10 normal"}},
+		{model.Webhook{Trigger: model.STATE},
+			[]float64{1, 2, 0, 0, 3}, []string{"0 off", "3 on"}},
+		{model.Webhook{},
+			[]float64{1, 2, 2, 0}, []string{"2 ", "0 "}},
+	}
+	for _, test := range tests {
+		h := &hook{settings: test.settings, states: make(map[string]string)}
+		var previous *model.Metric
+		var fired []string
+		for _, v := range test.values {
+			current := &model.Metric{Key: "c:d:r", RawValue: v, Value: v}
+			if event, ok := h.evaluate(bridge.Change{Previous: previous, Current: current}); ok {
+				fired = append(fired, fmt.Sprintf("%v %s", v, event.State))
+			}
+			previous = current
+		}
+		if !slices.Equal(fired, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.settings.GetTrigger(), test.expected, fired)
+		}
+	}
+}